@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/spf13/cobra"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/config"
+)
+
+var validateConfigFile string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate the config file and print its JSON Schema",
+	Long: `A CLI utility to check the config file passed to --config before onboarding, and to print the JSON Schema of
+the versioned config file for the completion and validation of the editors.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file without onboarding anything",
+	Run: func(cmd *cobra.Command, args []string) {
+		if validateConfigFile == "" {
+			log.Fatal("The --config flag is required")
+		}
+		paramsSlice, err := config.Load(validateConfigFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := config.Validate(paramsSlice); err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Infof("[Info]: The config file '%v' is valid, it onboards %v infras", validateConfigFile, len(paramsSlice))
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the versioned config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := printJSON(config.Schema()); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+func init() {
+	configValidateCmd.Flags().StringVar(&validateConfigFile, "config", "", "Config file to validate")
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/spf13/cobra"
+	"github.com/uditgaurav/onboard_hce_aws/execute"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+var deregisterParams types.OnboardingParameters
+var deregisterOpts types.DeregisterOptions
+
+var deregisterCmd = &cobra.Command{
+	Use:   "deregister",
+	Short: "Remove a Harness Chaos infrastructure and the AWS resources created for it",
+	Long: `A CLI utility to reverse the onboarding done by register. It deletes the chaos infra from the cluster and Harness,
+the chaos policy and role from AWS and the role annotation from the experiment service account.
+Only the resources created by this cli are deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if configFile != "" && deregisterOpts.InfraID != "" {
+			log.Fatal("The --infra-id flag can't be used with --config, the infra ID is read from the state file of each entry")
+		}
+		for _, params := range loadParams(deregisterParams) {
+			deregisterInfra(params)
+		}
+	},
+}
+
+func deregisterInfra(params types.OnboardingParameters) {
+
+	if err := execute.Deregister(params, deregisterOpts); err != nil {
+		log.Fatalf("fail to deregister chaos infra, err: %v", err)
+	}
+}
+
+func init() {
+	addCommonFlags(deregisterCmd, &deregisterParams)
+	deregisterCmd.Flags().StringVar(&deregisterParams.IAM.Path, "iam-path", "", "Path the chaos policies were created under (default /)")
+
+	deregisterCmd.Flags().StringVar(&deregisterOpts.InfraID, "infra-id", "", "ID of the chaos infra, the recorded one or looked up by infra-name when not provided")
+	deregisterCmd.Flags().BoolVar(&deregisterOpts.DeleteEnvironment, "delete-environment", false, "Delete the chaos environment as well")
+	deregisterCmd.Flags().BoolVar(&deregisterOpts.DeleteOIDCProvider, "delete-oidc-provider", false, "Delete the OIDC provider when no other role trusts it")
+}
@@ -8,81 +8,260 @@ import (
 	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/spf13/cobra"
 	"github.com/uditgaurav/onboard_hce_aws/execute"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/config"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
 )
 
 var params types.OnboardingParameters
-var osType, configFile string
+var osType, configFile, stateFile, outputFormat string
+var resume, continueOnError bool
+var parallelism int
+var trustSubjects []string
+var guardrailsFile string
 
 var rootCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register a new Harness Chaos infrastructure with AWS",
 	Long:  `A CLI utility to register a new Harness Chaos infrastructure with AWS account.`,
+	// The root command itself registers the infra, 'register' is accepted for backward compatibility
+	Args:      cobra.OnlyValidArgs,
+	ValidArgs: []string{"register"},
 	Run: func(cmd *cobra.Command, args []string) {
-		if osType == "linux" {
-			if params.AWSCredentialFile == "" {
-				params.AWSCredentialFile = fmt.Sprintf("%s/.aws/credentials", os.Getenv("HOME"))
-			}
-			if params.KubeConfigPath == "" {
-				params.KubeConfigPath = fmt.Sprintf("%s/.kube/config", os.Getenv("HOME"))
+		params.Resources = selectedResources(cmd, params.Resources)
+		subjects, err := parseTrustSubjects(trustSubjects)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		params.TrustSubjects = subjects
+		if guardrailsFile != "" {
+			if params.Guardrails, err = aws.LoadGuardrails(guardrailsFile); err != nil {
+				log.Fatalf("%v", err)
 			}
 		}
-		// Check if config file flag is provided
-		if configFile != "" {
-			// Read from the config file
-			configBytes, err := os.ReadFile(configFile)
-			if err != nil {
-				log.Fatalf("Unable to read config file: %v", err)
+		var planned, onboarded []types.OnboardingParameters
+		for _, params := range loadParams(params) {
+			if params.Dryrun {
+				planned = append(planned, params)
+				continue
 			}
+			onboarded = append(onboarded, params)
+		}
+		if len(onboarded) != 0 {
+			registerInfra(onboarded)
+		}
+		if len(planned) != 0 {
+			planInfra(planned)
+		}
+	},
+}
 
-			// Unmarshal JSON into params slice
-			var paramsSlice []types.OnboardingParameters
-			err = json.Unmarshal(configBytes, &paramsSlice)
-			if err != nil {
-				log.Fatalf("Unable to parse config JSON: %v", err)
-			}
+// loadParams will return the parameters for each infra, either from the config file or from the flags
+func loadParams(flagParams types.OnboardingParameters) []types.OnboardingParameters {
+	if osType == "linux" {
+		if flagParams.AWSCredentialFile == "" {
+			flagParams.AWSCredentialFile = fmt.Sprintf("%s/.aws/credentials", os.Getenv("HOME"))
+		}
+		if flagParams.KubeConfigPath == "" {
+			flagParams.KubeConfigPath = fmt.Sprintf("%s/.kube/config", os.Getenv("HOME"))
+		}
+	}
+	flagParams.StateFile = stateFile
+	flagParams.Resume = resume
+	// Check if config file flag is provided
+	if configFile == "" {
+		return []types.OnboardingParameters{flagParams}
+	}
 
-			// Iterate over each item in the paramsSlice
-			for _, params := range paramsSlice {
-				// Call the function using the params from the JSON
-				registerInfra(params)
-			}
-		} else {
-			// Call the function using the params from the flags
-			registerInfra(params)
+	// Read the yaml or json config file, the entries it leaves out settings of are completed by the flags below
+	paramsSlice, err := config.Load(configFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for i := range paramsSlice {
+		paramsSlice[i].StateFile = stateFile
+		paramsSlice[i].Resume = resume
+		paramsSlice[i].Dryrun = paramsSlice[i].Dryrun || flagParams.Dryrun
+		if paramsSlice[i].PolicyCatalog == "" {
+			paramsSlice[i].PolicyCatalog = flagParams.PolicyCatalog
 		}
-	},
+		if paramsSlice[i].Scope == (types.PolicyScope{}) {
+			paramsSlice[i].Scope = flagParams.Scope
+		}
+		if len(paramsSlice[i].Guardrails) == 0 {
+			paramsSlice[i].Guardrails = flagParams.Guardrails
+		}
+		if len(paramsSlice[i].TrustSubjects) == 0 {
+			paramsSlice[i].TrustSubjects = flagParams.TrustSubjects
+		}
+		if paramsSlice[i].IAM == (types.IAMOptions{}) {
+			paramsSlice[i].IAM = flagParams.IAM
+		}
+		// The naming settings left out of an entry default to the flags, field by field
+		if paramsSlice[i].Naming.Template == "" {
+			paramsSlice[i].Naming.Template = flagParams.Naming.Template
+		}
+		if paramsSlice[i].Naming.Cluster == "" {
+			paramsSlice[i].Naming.Cluster = flagParams.Naming.Cluster
+		}
+		if paramsSlice[i].Thumbprint == "" {
+			paramsSlice[i].Thumbprint = flagParams.Thumbprint
+		}
+		if paramsSlice[i].CABundle == "" {
+			paramsSlice[i].CABundle = flagParams.CABundle
+		}
+		if paramsSlice[i].EKSClusterName == "" {
+			paramsSlice[i].EKSClusterName = flagParams.EKSClusterName
+		}
+		if paramsSlice[i].KubeConfigPath == "" {
+			paramsSlice[i].KubeConfigPath = flagParams.KubeConfigPath
+		}
+		// Each entry can select its own context, the settings it leaves out come from the flags
+		if paramsSlice[i].Kube.Context == "" {
+			paramsSlice[i].Kube.Context = flagParams.Kube.Context
+		}
+		if paramsSlice[i].Kube.As == "" {
+			paramsSlice[i].Kube.As = flagParams.Kube.As
+		}
+		if paramsSlice[i].Kube.QPS == 0 {
+			paramsSlice[i].Kube.QPS = flagParams.Kube.QPS
+		}
+		if paramsSlice[i].Kube.Burst == 0 {
+			paramsSlice[i].Kube.Burst = flagParams.Kube.Burst
+		}
+	}
+	return paramsSlice
+}
+
+// selectedResources will return the resource groups of --resources, which default to 'all' unless faults are
+// selected with --faults
+func selectedResources(cmd *cobra.Command, resources string) string {
+	if cmd.Flags().Changed("faults") && !cmd.Flags().Changed("resources") {
+		return ""
+	}
+	return resources
 }
 
-func registerInfra(params types.OnboardingParameters) {
+// registerInfra will onboard each infra. The infras of a config file are onboarded as a batch, which reports the
+// outcome of every entry instead of stopping at the first failure.
+func registerInfra(paramsSlice []types.OnboardingParameters) {
+
+	if configFile == "" {
+		if _, err := execute.Execute(paramsSlice[0]); err != nil {
+			log.Fatalf("fail to register chaos infra with aws, err: %v", err)
+		}
+		return
+	}
 
-	if err := os.Setenv("AWS_SHARED_CREDENTIALS_FILE", params.AWSCredentialFile); err != nil {
-		log.Fatalf("Failed to set AWS_SHARED_CREDENTIALS_FILE environment variable, err: %v", err)
+	// The entries onboarded in parallel must not share an infra, and an invalid entry fails the batch before any change
+	if err := config.Validate(paramsSlice); err != nil {
+		log.Fatalf("%v", err)
 	}
-	if err := os.Setenv("AWS_PROFILE", params.AWSProfile); err != nil {
-		log.Fatalf("Failed to set AWS_PROFILE environment variable, err: %v", err)
+	report := execute.ExecuteBatch(paramsSlice, parallelism, continueOnError)
+	if outputFormat == "json" {
+		if err := printJSON(report); err != nil {
+			log.Fatalf("%v", err)
+		}
+	} else if err := report.Print(os.Stdout); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if report.Failed != 0 {
+		os.Exit(1)
+	}
+}
+
+// planInfra will print the changes the onboarding would make for each infra, without making any of them
+func planInfra(paramsSlice []types.OnboardingParameters) {
+
+	var plans []*execute.OnboardingPlan
+	for _, params := range paramsSlice {
+		plan, err := execute.Plan(params)
+		if err != nil {
+			log.Fatalf("fail to plan the onboarding of chaos infra '%v', err: %v", params.Infra.Name, err)
+		}
+		plans = append(plans, plan)
 	}
 
-	if err := os.Setenv("KUBECONFIG", params.KubeConfigPath); err != nil {
-		log.Fatalf("Failed to set KUBECONFIG environment variable, err: %v", err)
+	if outputFormat == "json" {
+		if err := printJSON(plans); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+	for _, plan := range plans {
+		if err := plan.Print(os.Stdout); err != nil {
+			log.Fatalf("%v", err)
+		}
 	}
+}
 
-	// Now proceed with the execution
-	if err := execute.Execute(params); err != nil {
-		log.Fatalf("fail to register chaos infra with aws, err: %v", err)
+// printJSON will write the given value to stdout as indented JSON
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the output, err: %v", err)
 	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// addCommonFlags will add the flags shared by all the commands which act on an onboarded infra
+func addCommonFlags(cmd *cobra.Command, params *types.OnboardingParameters) {
+	cmd.Flags().StringVar(&params.ApiKey, "api-key", "", "API Key for Harness")
+	cmd.Flags().StringVar(&params.AccountId, "account-id", "", "Account ID for Harness")
+	cmd.Flags().StringVar(&params.Infra.Name, "infra-name", "", "Name of the Harness Chaos infrastructure")
+	cmd.Flags().StringVar(&params.Project, "project", "", "Project Identifier")
+
+	cmd.Flags().StringVar(&osType, "os", "", "Operating System type (e.g. linux)")
+	cmd.Flags().StringVar(&params.Infra.Namespace, "infra-namespace", "hce", "Namespace for the Harness Chaos infrastructure")
+	cmd.Flags().StringVar(&params.Organisation, "organisation", "default", "Organisation Identifier")
+	cmd.Flags().StringVar(&params.Environment.EnvironmentName, "environment-name", "", "Environment Name")
+
+	// Flags for aws setup
+	cmd.Flags().StringVar(&params.ProviderUrl, "provider-url", "", "Provider URL, discovered from the cluster when not provided")
+	cmd.Flags().StringVar(&params.EKSClusterName, "eks-cluster-name", "", "Name of the EKS cluster to connect to, without a kubeconfig, and whose OIDC issuer is used as provider URL")
+	cmd.Flags().StringVar(&params.Thumbprint, "thumbprint", "", "Thumbprint of the OIDC provider, computed from the issuer when not provided")
+	cmd.Flags().StringVar(&params.CABundle, "ca-bundle", "", "PEM file of CA certificates trusted along with the system roots to verify the issuer")
+	cmd.Flags().StringVar(&params.RoleName, "role-name", "", "Role Name")
+	cmd.Flags().StringVar(&params.Region, "region", "", "Target AWS Region")
+	cmd.Flags().StringVar(&params.ExperimentServiceAccountName, "service-account", "litmus-admin", "Experiment Service Account Name")
+	cmd.Flags().StringVar(&params.KubeConfigPath, "kubeconfig-path", "", "Path to the kubeconfig file")
+	cmd.Flags().StringVar(&params.Kube.Context, "kube-context", "", "Context of the kubeconfig to use (default the current context)")
+	cmd.Flags().StringVar(&params.Kube.As, "kube-as", "", "User or service account the requests to the cluster are impersonated as")
+	cmd.Flags().Float32Var(&params.Kube.QPS, "kube-qps", 0, "Maximum queries per second to the cluster (default 5)")
+	cmd.Flags().IntVar(&params.Kube.Burst, "kube-burst", 0, "Maximum burst of queries to the cluster (default 10)")
+	cmd.Flags().StringVar(&params.AWSCredentialFile, "aws-credential-file", "", "Path To The AWS Credential File (default $HOME/.aws/credentials)")
+	cmd.Flags().StringVar(&params.AWSProfile, "aws-profile", "default", "Provide the AWS profile (Default 'default')")
+	cmd.Flags().StringVar(&configFile, "config", "", "Config file containing parameters")
+	cmd.Flags().StringVar(&stateFile, "state-file", state.DefaultPath(), "Path to the file recording the onboarding state")
+	cmd.Flags().StringVar(&params.Naming.Template, "name-template", aws.DefaultNameTemplate, "Template of the role and policy names with the .Prefix, .Cluster and .Namespace fields")
+	cmd.Flags().StringVar(&params.Naming.Cluster, "cluster-name", "", "Name of the cluster used by the .Cluster field of the naming template")
+}
+
+// addScopeFlags will add the flags restricting the mutating actions of the chaos policy
+func addScopeFlags(cmd *cobra.Command, scope *types.PolicyScope) {
+	cmd.Flags().StringVar(&scope.Tags, "scope-tags", "", "Comma separated key=value tags the resources must have for the mutating actions")
+	cmd.Flags().StringVar(&scope.ResourceARNs, "scope-arns", "", "Comma separated ARNs of the resources the mutating actions of their service are limited to")
+	cmd.Flags().StringVar(&scope.Regions, "scope-regions", "", "Comma separated regions the mutating actions are limited to")
+	cmd.Flags().StringVar(&scope.VPCs, "scope-vpcs", "", "Comma separated VPC IDs the mutating network actions are limited to")
+}
+
+// addIAMFlags will add the flags for the organisation requirements of the created IAM resources
+func addIAMFlags(cmd *cobra.Command, options *types.IAMOptions) {
+	cmd.Flags().StringVar(&options.PermissionsBoundary, "permissions-boundary", "", "ARN of the managed policy set as permissions boundary of the created role")
+	cmd.Flags().StringVar(&options.Tags, "iam-tags", "", "Comma separated key=value tags added to the created role, policies and OIDC provider")
+	cmd.Flags().StringVar(&options.Path, "iam-path", "", "Path of the created role and policies, like /chaos/ (default /)")
+	cmd.Flags().StringVar(&options.Description, "role-description", "", "Description of the created role and policies")
+	cmd.Flags().IntVar(&options.MaxSessionDuration, "max-session-duration", 0, "Maximum session duration of the created role in seconds, between 3600 and 43200 (default 3600)")
+	cmd.Flags().StringVar(&options.ManagedPolicyARNs, "attach-policy-arns", "", "Comma separated ARNs of existing customer or AWS managed policies attached to the chaos role")
+	cmd.Flags().BoolVar(&options.InlinePolicy, "inline-policy", false, "Put the chaos policy inline in the created role instead of creating managed policies")
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&params.ApiKey, "api-key", "", "API Key for Harness")
-	rootCmd.Flags().StringVar(&params.AccountId, "account-id", "", "Account ID for Harness")
-	rootCmd.Flags().StringVar(&params.Infra.Name, "infra-name", "", "Name of the Harness Chaos infrastructure")
-	rootCmd.Flags().StringVar(&params.Project, "project", "", "Project Identifier")
+	addCommonFlags(rootCmd, &params)
 
 	// Default value for infra-environment-id and infra-platform-name is calculated in RegisterInfra based on infra-name
-	rootCmd.Flags().StringVar(&osType, "os", "", "Operating System type (e.g. linux)")
-	rootCmd.Flags().StringVar(&params.Infra.Namespace, "infra-namespace", "hce", "Namespace for the Harness Chaos infrastructure")
-	rootCmd.Flags().StringVar(&params.Organisation, "organisation", "default", "Organisation Identifier")
 	rootCmd.Flags().StringVar(&params.Infra.InfraScope, "infra-scope", "namespace", "Infrastructure Scope")
 	rootCmd.Flags().BoolVar(&params.Infra.InfraNsExists, "infra-ns-exists", true, "Does infrastructure namespace exist")
 	rootCmd.Flags().StringVar(&params.Infra.InfraDescription, "infra-description", "Infra for Harness Chaos Testing", "Infra Description")
@@ -91,28 +270,33 @@ func init() {
 
 	rootCmd.Flags().StringVar(&params.Infra.ServiceAccount, "infra-service-account", "hce", "Infra Service Account")
 	rootCmd.Flags().BoolVar(&params.Infra.InfraSaExists, "is-infra-sa-exists", false, "Does infrastructure service account exist")
-	rootCmd.Flags().StringVar(&params.Environment.EnvironmentName, "environment-name", "", "Environment Name")
 	rootCmd.Flags().StringVar(&params.Infra.PlatformName, "infra-platform-name", "", "Infra Platform Name")
 	rootCmd.Flags().BoolVar(&params.Infra.SkipSsl, "infra-skip-ssl", false, "Skip SSL for Infra")
 	rootCmd.Flags().BoolVar(&params.Infra.IsAutoUpgradeEnabled, "auto-upgrade", false, "Infra auto upgrade")
-	rootCmd.Flags().BoolVar(&params.Dryrun, "dry-run", false, "To Show the policy JSON")
+	rootCmd.Flags().BoolVar(&params.Dryrun, "dry-run", false, "Show the planned changes without making any of them")
+	rootCmd.Flags().StringVar(&outputFormat, "output", "text", "Output format of the dry run plan and the batch report, text or json")
 	rootCmd.Flags().BoolVar(&params.CreateNS, "create-ns", false, "To create chaos infra namespace")
 
 	rootCmd.Flags().IntVar(&params.Timeout, "timeout", 180, "Timeout For Infra setup")
 	rootCmd.Flags().IntVar(&params.Delay, "delay", 2, "Delay between checking the status of Infra")
 
-	// Flags for aws setup
-	rootCmd.Flags().StringVar(&params.ProviderUrl, "provider-url", "", "Provider URL")
-	rootCmd.Flags().StringVar(&params.RoleName, "role-name", "", "Role Name")
 	rootCmd.Flags().StringVar(&params.Resources, "resources", "all", "Resources")
-	rootCmd.Flags().StringVar(&params.Region, "region", "", "Target AWS Region")
-	rootCmd.Flags().StringVar(&params.ExperimentServiceAccountName, "service-account", "litmus-admin", "Experiment Service Account Name")
-	rootCmd.Flags().StringVar(&params.KubeConfigPath, "kubeconfig-path", "", "Path to the kubeconfig file")
+	rootCmd.Flags().StringVar(&params.Faults, "faults", "", "Comma separated faults to grant the minimal permissions for, --resources is only added when set explicitly")
+	rootCmd.Flags().StringVar(&params.PolicyCatalog, "policy-catalog", "", "Directory of policy catalog files adding or overriding resource groups")
+	addScopeFlags(rootCmd, &params.Scope)
+	addIAMFlags(rootCmd, &params.IAM)
+	rootCmd.Flags().StringVar(&guardrailsFile, "guardrails", "", "YAML or JSON file of guardrails denying the chaos actions on protected resources")
+	rootCmd.Flags().StringArrayVar(&trustSubjects, "trust-subject", nil, "Extra service account trusted by the chaos role, <namespace>:<service-account>[@<provider-url>], can be repeated")
 	rootCmd.Flags().StringVar(&params.Actions, "actions", "all", "Actions that are performed by this cli. (Default all)")
-	rootCmd.Flags().StringVar(&params.AWSCredentialFile, "aws-credential-file", "", "Path To The AWS Credential File (default $HOME/.aws/credentials)")
-	rootCmd.Flags().StringVar(&params.AWSProfile, "aws-profile", "default", "Provide the AWS profile (Default 'default')")
-	rootCmd.Flags().StringVar(&configFile, "config", "", "Config file containing parameters")
+	rootCmd.Flags().BoolVar(&resume, "resume", false, "Skip the steps completed by a previous run and continue from the failed one")
+	rootCmd.Flags().IntVar(&parallelism, "parallelism", 1, "Number of entries of the config file onboarded at a time")
+	rootCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "Keep onboarding the entries of the config file after one fails")
 
+	rootCmd.AddCommand(deregisterCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(policyCmd)
+	rootCmd.AddCommand(trustCmd)
+	rootCmd.AddCommand(configCmd)
 }
 
 func main() {
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/spf13/cobra"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+var policyResources, policyFaults, policyOutput, policyCatalog, policyGuardrails string
+var policyListFaults bool
+var policyScope types.PolicyScope
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Render, explain and list the IAM policies of the chaos role offline",
+	Long: `A CLI utility to inspect the policy created for the chaos role from the resource groups passed to --resources.
+It works offline and needs neither Harness, cluster nor AWS credentials.`,
+}
+
+var policyRenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Print the policy merged from the given resource groups and faults, split into documents within the size limit",
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := policyRegistry()
+		policy, err := registry.Build(selectedResources(cmd, policyResources), policyFaults)
+		if err != nil {
+			log.Fatalf("fail to render the policy, err: %v", err)
+		}
+		if policy, err = registry.ScopePolicy(policy, policyScope); err != nil {
+			log.Fatalf("fail to render the policy, err: %v", err)
+		}
+		if policyGuardrails != "" {
+			guardrails, err := aws.LoadGuardrails(policyGuardrails)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			results, err := registry.Guardrails(policy, guardrails)
+			if err != nil {
+				log.Fatalf("fail to render the policy, err: %v", err)
+			}
+			for _, result := range results {
+				for _, issue := range result.Issues {
+					log.Warnf("[Warning]: The guardrail '%v' doesn't protect everything it selects: %v", result.Name, issue)
+				}
+			}
+			if policy, err = aws.ApplyGuardrails(policy, results); err != nil {
+				log.Fatalf("fail to render the policy, err: %v", err)
+			}
+		}
+		policies, err := aws.SplitPolicy(policy)
+		if err != nil {
+			log.Fatalf("fail to render the policy, err: %v", err)
+		}
+		for i, policy := range policies {
+			size, err := aws.PolicySize(policy)
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			log.Infof("[Info]: Policy document %v of %v, %v characters", i+1, len(policies), size)
+			if err := printJSON(policy); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+	},
+}
+
+var policyExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "List each action of the policy and the resource groups and faults which need it",
+	Run: func(cmd *cobra.Command, args []string) {
+		sources, err := policyRegistry().Explain(selectedResources(cmd, policyResources), policyFaults)
+		if err != nil {
+			log.Fatalf("fail to explain the policy, err: %v", err)
+		}
+		if policyOutput == "json" {
+			if err := printJSON(sources); err != nil {
+				log.Fatalf("%v", err)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tRESOURCE GROUPS\tFAULTS")
+		for _, source := range sources {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", source.Action, strings.Join(source.ResourceGroups, ", "), strings.Join(source.Faults, ", "))
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+var policyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the supported resource groups, or faults, and their number of actions",
+	Run: func(cmd *cobra.Command, args []string) {
+		header := "RESOURCE GROUP"
+		groups := policyRegistry().ResourceGroups()
+		if policyListFaults {
+			header = "FAULT"
+			groups = policyRegistry().FaultGroups()
+		}
+		if policyOutput == "json" {
+			if err := printJSON(groups); err != nil {
+				log.Fatalf("%v", err)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, header+"\tACTIONS\tSOURCE\tDESCRIPTION")
+		for _, group := range groups {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", group.Name, group.Actions, group.Source, group.Description)
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	},
+}
+
+// policyRegistry will load the policy catalog along with the files of --policy-catalog
+func policyRegistry() *aws.Registry {
+	registry, err := aws.NewRegistry(policyCatalog)
+	if err != nil {
+		log.Fatalf("fail to load the policy catalog, err: %v", err)
+	}
+	return registry
+}
+
+func init() {
+	policyRenderCmd.Flags().StringVar(&policyResources, "resources", "all", "Comma separated resource groups of the policy")
+	policyRenderCmd.Flags().StringVar(&policyFaults, "faults", "", "Comma separated faults of the policy, --resources is only added when set explicitly")
+	addScopeFlags(policyRenderCmd, &policyScope)
+	policyRenderCmd.Flags().StringVar(&policyGuardrails, "guardrails", "", "YAML or JSON file of guardrails denying the chaos actions on protected resources")
+	policyExplainCmd.Flags().StringVar(&policyResources, "resources", "all", "Comma separated resource groups of the policy")
+	policyExplainCmd.Flags().StringVar(&policyFaults, "faults", "", "Comma separated faults of the policy, --resources is only added when set explicitly")
+	policyExplainCmd.Flags().StringVar(&policyOutput, "output", "text", "Output format, text or json")
+	policyListCmd.Flags().StringVar(&policyOutput, "output", "text", "Output format, text or json")
+	policyListCmd.Flags().BoolVar(&policyListFaults, "faults", false, "List the supported faults instead of the resource groups")
+
+	policyCmd.PersistentFlags().StringVar(&policyCatalog, "policy-catalog", "", "Directory of policy catalog files adding or overriding resource groups")
+
+	policyCmd.AddCommand(policyRenderCmd, policyExplainCmd, policyListCmd)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/spf13/cobra"
+	"github.com/uditgaurav/onboard_hce_aws/execute"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+var statusParams types.OnboardingParameters
+var statusInfraID, statusOutput string
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the health of an onboarded Harness Chaos infrastructure",
+	Long: `A CLI utility to check an onboarded chaos infra end to end. It reports the state of the infra in Harness,
+the readiness of its pods in the cluster, the role annotation of the experiment service account and whether
+the role trusts the OIDC provider and grants the actions needed by --resources.
+It exits with a non-zero code when any of the checks is degraded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if configFile != "" && statusInfraID != "" {
+			log.Fatal("The --infra-id flag can't be used with --config, the infra ID is looked up by infra name for each entry")
+		}
+
+		statusParams.Resources = selectedResources(cmd, statusParams.Resources)
+		var statuses []*execute.InfraStatus
+		healthy := true
+		for _, params := range loadParams(statusParams) {
+			status, err := execute.Status(params, statusInfraID)
+			if err != nil {
+				log.Fatalf("fail to get the status of chaos infra '%v', err: %v", params.Infra.Name, err)
+			}
+			statuses = append(statuses, status)
+			healthy = healthy && status.Healthy
+		}
+
+		if statusOutput == "json" {
+			if err := printJSON(statuses); err != nil {
+				log.Fatalf("%v", err)
+			}
+		} else {
+			for _, status := range statuses {
+				if err := status.Print(os.Stdout); err != nil {
+					log.Fatalf("%v", err)
+				}
+			}
+		}
+		if !healthy {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addCommonFlags(statusCmd, &statusParams)
+
+	statusCmd.Flags().StringVar(&statusInfraID, "infra-id", "", "ID of the chaos infra, looked up by infra-name when not provided")
+	statusCmd.Flags().StringVar(&statusParams.Resources, "resources", "all", "Resources the chaos role is expected to cover")
+	statusCmd.Flags().StringVar(&statusParams.Faults, "faults", "", "Faults the chaos role is expected to cover, --resources is only added when set explicitly")
+	statusCmd.Flags().StringVar(&statusParams.PolicyCatalog, "policy-catalog", "", "Directory of policy catalog files adding or overriding resource groups")
+	statusCmd.Flags().StringVar(&statusOutput, "output", "text", "Output format of the status, text or json")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/spf13/cobra"
+	"github.com/uditgaurav/onboard_hce_aws/execute"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+var trustParams types.OnboardingParameters
+var trustSubjectFlags []string
+var trustOutput string
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Manage the service accounts trusted by the chaos role",
+	Long: `A CLI utility to add or remove the service accounts allowed to assume the chaos role, from any namespace
+or cluster, without recreating the role. A subject has the form <namespace>:<service-account>[@<provider-url>],
+the namespace and service account can contain '*' and '?' wildcards and the provider URL defaults to --provider-url.`,
+}
+
+var trustAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Allow the subjects to assume the chaos role",
+	Run: func(cmd *cobra.Command, args []string) {
+		updateTrust(false)
+	},
+}
+
+var trustRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Stop trusting the subjects with the chaos role",
+	Run: func(cmd *cobra.Command, args []string) {
+		updateTrust(true)
+	},
+}
+
+var trustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the service accounts trusted by the chaos role",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, params := range loadParams(trustParams) {
+			subjects, err := execute.ListTrust(params)
+			if err != nil {
+				log.Fatalf("fail to list the trust subjects of the chaos role, err: %v", err)
+			}
+			if trustOutput == "json" {
+				if err := printJSON(subjects); err != nil {
+					log.Fatalf("%v", err)
+				}
+				continue
+			}
+			if err := printTrustSubjects(subjects); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+	},
+}
+
+// updateTrust will add or remove the subjects of --subject to the trust policy of the chaos role of each infra
+func updateTrust(remove bool) {
+	subjects, err := parseTrustSubjects(trustSubjectFlags)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if len(subjects) == 0 {
+		log.Fatal("At least one --subject is required")
+	}
+
+	for _, params := range loadParams(trustParams) {
+		update, err := execute.UpdateTrust(params, subjects, remove)
+		if err != nil {
+			log.Fatalf("fail to update the trust policy of the chaos role, err: %v", err)
+		}
+		if params.Dryrun && update.Changed {
+			fmt.Printf("Planned changes to the trust policy of role '%v':\n\n%v", update.RoleName, update.Diff)
+		}
+	}
+}
+
+// parseTrustSubjects will parse the subjects given as <namespace>:<service-account>[@<provider-url>]
+func parseTrustSubjects(values []string) ([]types.TrustSubject, error) {
+	var subjects []types.TrustSubject
+	for _, value := range values {
+		subject, err := aws.ParseTrustSubject(value)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, nil
+}
+
+// printTrustSubjects will write the trusted subjects as a table
+func printTrustSubjects(subjects []aws.TrustedSubject) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBJECT\tOPERATOR\tPROVIDER")
+	for _, subject := range subjects {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", subject.Subject, subject.Operator, subject.ProviderARN)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{trustAddCmd, trustRemoveCmd, trustListCmd} {
+		addCommonFlags(cmd, &trustParams)
+		trustCmd.AddCommand(cmd)
+	}
+	for _, cmd := range []*cobra.Command{trustAddCmd, trustRemoveCmd} {
+		cmd.Flags().StringArrayVar(&trustSubjectFlags, "subject", nil, "Subject to trust, <namespace>:<service-account>[@<provider-url>], can be repeated")
+		cmd.Flags().BoolVar(&trustParams.Dryrun, "dry-run", false, "Show the changes to the trust policy without making them")
+	}
+	trustListCmd.Flags().StringVar(&trustOutput, "output", "text", "Output format of the trust subjects, text or json")
+}
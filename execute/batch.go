@@ -0,0 +1,123 @@
+package execute
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// The results of the onboarding of an entry of a batch
+const (
+	batchSucceeded = "succeeded"
+	batchFailed    = "failed"
+	batchSkipped   = "skipped"
+)
+
+// BatchResult is the outcome of the onboarding of a single entry of a batch
+type BatchResult struct {
+	InfraName string `json:"infraName"`
+	Status    string `json:"status"`
+	InfraID   string `json:"infraID,omitempty"`
+	RoleARN   string `json:"roleARN,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchReport is the outcome of the onboarding of every entry of a batch, in the order of the entries
+type BatchReport struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+}
+
+// ExecuteBatch will onboard the entries, at most parallelism of them at a time. Each entry uses its own aws session
+// and cluster clients, so the entries don't share any process wide setting. Unless continueOnError is set, the
+// entries not started yet are skipped after the first failure, the ones already running are completed.
+func ExecuteBatch(paramsSlice []types.OnboardingParameters, parallelism int, continueOnError bool) *BatchReport {
+
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := make([]BatchResult, len(paramsSlice))
+
+	var mu sync.Mutex
+	failed := false
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelism)
+	for i, params := range paramsSlice {
+		slots <- struct{}{}
+		mu.Lock()
+		stop := failed && !continueOnError
+		mu.Unlock()
+		if stop {
+			<-slots
+			results[i] = BatchResult{InfraName: params.Infra.Name, Status: batchSkipped, Error: "skipped after the failure of a previous entry"}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, params types.OnboardingParameters) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			log.Infof("[Info]: Onboarding chaos infra '%v'", params.Infra.Name)
+			result := BatchResult{InfraName: params.Infra.Name, Status: batchSucceeded}
+			infraState, err := executeEntry(params)
+			if infraState != nil {
+				result.InfraID = infraState.InfraID
+				result.RoleARN = infraState.RoleARN
+			}
+			if err != nil {
+				log.Errorf("[Error]: Failed to onboard chaos infra '%v', err: %v", params.Infra.Name, err)
+				result.Status = batchFailed
+				result.Error = err.Error()
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			results[i] = result
+		}(i, params)
+	}
+	wg.Wait()
+
+	report := &BatchReport{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case batchSucceeded:
+			report.Succeeded++
+		case batchFailed:
+			report.Failed++
+		default:
+			report.Skipped++
+		}
+	}
+	return report
+}
+
+// executeEntry will onboard an entry of a batch, a panic of the onboarding fails the entry rather than the batch
+func executeEntry(params types.OnboardingParameters) (infraState *state.InfraState, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("the onboarding panicked, err: %v", r)
+		}
+	}()
+	return Execute(params)
+}
+
+// Print will write the outcome of each entry as a table
+func (r *BatchReport) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Onboarded %v of %v chaos infras, %v failed, %v skipped:\n\n", r.Succeeded, len(r.Results), r.Failed, r.Skipped)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INFRA\tSTATUS\tINFRA ID\tROLE ARN\tERROR")
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", result.InfraName, result.Status, result.InfraID, result.RoleARN, result.Error)
+	}
+	return tw.Flush()
+}
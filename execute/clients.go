@@ -0,0 +1,23 @@
+package execute
+
+import (
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// newClients will create the clients of the cluster of the params and print the cluster they connect to, before
+// anything is changed in it
+func newClients(params types.OnboardingParameters) (*clients.ClientSets, error) {
+
+	clientSets := &clients.ClientSets{}
+	if err := clientSets.GenerateClientSet(clients.NewOptions(params)); err != nil {
+		return nil, errors.Errorf("Failed to initialize KubeClient: %v", err)
+	}
+	log.Infof("[Info]: Using the cluster '%v' of context '%v'", clientSets.KubeConfig.Host, clientSets.Context)
+	if params.Kube.As != "" {
+		log.Infof("[Info]: The requests to the cluster are impersonated as '%v'", params.Kube.As)
+	}
+	return clientSets, nil
+}
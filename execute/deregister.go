@@ -0,0 +1,136 @@
+package execute
+
+import (
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/kubernetes"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/register"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// Deregister will reverse the onboarding performed by Execute. It only deletes the objects
+// which carry the markers added by this cli while registering.
+func Deregister(params types.OnboardingParameters, opts types.DeregisterOptions) error {
+	clients, err := newClients(params)
+	if err != nil {
+		return err
+	}
+	if err := resolveIssuer(&params, clients, opts.DeleteOIDCProvider); err != nil {
+		return err
+	}
+
+	store, err := state.Load(params.StateFile)
+	if err != nil {
+		return err
+	}
+	infraState := store.Get(params)
+
+	infraID, err := ownedInfraID(params, opts.InfraID, infraState)
+	if err != nil {
+		return err
+	}
+	log.Infof("[Info]: The infraId is: %v", infraID)
+
+	// Remove the role annotation before the role, the roleARN can't be derived once the role is deleted
+	if err := removeRoleAnnotation(params, *clients); err != nil {
+		return err
+	}
+
+	// The objects are the ones recorded while applying the manifest, the current manifest may list other ones
+	if infraState.InfraID == infraID && len(infraState.AppliedObjects) != 0 {
+		if err := register.DeleteChaosManifest(infraID, infraState.AppliedObjects, *clients); err != nil {
+			return errors.Errorf("failed to delete chaos infra manifest, err: %v", err)
+		}
+	} else {
+		log.Warnf("[Warning]: Skipping the deletion of the chaos infra manifest, no applied object is recorded for infra '%v' in the state file", infraID)
+	}
+	if err := register.DeleteInfra(infraID, params); err != nil {
+		return errors.Errorf("failed to remove ChaosInfra, err: %v", err)
+	}
+	if opts.DeleteEnvironment {
+		if err := register.DeleteChaosEnvironment(infraID, params); err != nil {
+			return errors.Errorf("failed to delete chaos environment, err: %v", err)
+		}
+	}
+
+	if err := aws.DeleteRoleAndPolicy(params); err != nil {
+		return errors.Errorf("failed to delete policy and role, err: %v", err)
+	}
+	if opts.DeleteOIDCProvider {
+		if err := aws.DeleteOIDCProvider(params); err != nil {
+			return errors.Errorf("failed to delete OIDC provider, err: %v", err)
+		}
+	}
+
+	store.Remove(params)
+	return store.Save()
+}
+
+// ownedInfraID will return the ID of the chaos infra to delete, which must either be recorded in the state file or
+// carry the tag added by this cli while registering. An infra found by name only is never trusted.
+func ownedInfraID(params types.OnboardingParameters, infraID string, infraState *state.InfraState) (string, error) {
+
+	if infraID == "" {
+		infraID = infraState.InfraID
+	}
+	if infraID != "" && infraID == infraState.InfraID {
+		return infraID, nil
+	}
+	if infraID == "" {
+		id, err := register.GetInfraID(params)
+		if err != nil {
+			return "", errors.Errorf("failed to get the chaos infra ID, err: %v", err)
+		}
+		infraID = id
+	}
+
+	managed, err := register.IsManagedInfra(infraID, params)
+	if err != nil {
+		return "", errors.Errorf("failed to get the chaos infra '%v', err: %v", infraID, err)
+	}
+	if !managed {
+		return "", errors.Errorf("refusing to delete the chaos infra '%v', it is neither recorded in the state file '%v' nor tagged with '%v' by this cli", infraID, params.StateFile, types.ManagedInfraTag)
+	}
+	return infraID, nil
+}
+
+// removeRoleAnnotation will remove the annotation of the chaos role from the experiment service account, when the
+// role is one this cli deletes or detaches its policies from: the role of the naming template created by this cli
+// or the role provided by the user
+func removeRoleAnnotation(params types.OnboardingParameters, clients clients.ClientSets) error {
+
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return err
+	}
+	if err := aws.CheckRoleCluster(params); err != nil {
+		return err
+	}
+	exists, managed, err := aws.RoleExists(params, roleName)
+	if err != nil {
+		return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	if !exists {
+		log.Warnf("[Warning]: Skipping the removal of service account annotation, the role '%v' doesn't exist", roleName)
+		return nil
+	}
+	if !managed && strings.TrimSpace(params.RoleName) == "" {
+		log.Warnf("[Warning]: Skipping the removal of service account annotation, the role '%v' was not created by this cli", roleName)
+		return nil
+	}
+
+	roleARN, err := aws.GetRoleARN(params, roleName)
+	if err != nil {
+		log.Warnf("[Warning]: Skipping the removal of service account annotation, failed to get the roleARN of '%v', err: %v", roleName, err)
+		return nil
+	}
+	if err := kubernetes.RemoveServiceAccountAnnotation(roleARN, params, clients); err != nil {
+		return errors.Errorf("failed to remove the role annotation from experiment service account, err: %v", err)
+	}
+	return nil
+}
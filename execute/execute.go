@@ -1,112 +1,260 @@
 package execute
 
 import (
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/kubernetes"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/register"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
 )
 
-func Execute(params types.OnboardingParameters) error {
-	// Create a new ClientSets
-	clients := &clients.ClientSets{}
+// onboarding holds everything shared between the steps of a single onboarding
+type onboarding struct {
+	params   types.OnboardingParameters
+	clients  clients.ClientSets
+	store    *state.Store
+	state    *state.InfraState
+	manifest string
+	// inlinePolicies are the chaos policy documents put inline in the role, they are prepared again on resume
+	inlinePolicies []aws.Policy
+	roleName       string
+}
 
-	// Initialize KubeClient
-	if err := clients.GenerateClientSetFromKubeConfig(); err != nil {
-		return errors.Errorf("Failed to initialize KubeClient: %v", err)
+// Execute will run the requested steps of the onboarding and return the state of the infra, which holds the outputs
+// of the completed steps even when a step fails
+func Execute(params types.OnboardingParameters) (*state.InfraState, error) {
+	// A dry run must not make any change, use Plan for it
+	if params.Dryrun {
+		return nil, errors.New("the onboarding can't be executed in dry run mode, use Plan instead")
 	}
 
-	switch params.Actions {
+	store, err := state.Load(params.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	infraState := store.Get(params)
 
-	case "all":
-		if params.CreateNS {
-			if err := kubernetes.CreateNS(params.Infra.Namespace, *clients); err != nil {
-				return errors.Errorf("failed to create ns, err: %v", err)
-			}
-		}
-		if err := register.RegisterInfra(params); err != nil {
-			return errors.Errorf("failed to register ChaosInfra, err: %v", err)
-		}
-		providerARN, err := aws.ConnectOIDCProvider(params)
-		if err != nil {
-			return errors.Errorf("failed to connect OIDC provider, err: %v", err)
-		}
-		params.ProviderARN = providerARN
-		if params.RoleName == "" {
-			if err := aws.PreparePolicyAndCreateRole(params); err != nil {
-				return errors.Errorf("failed to create policy and role, err: %v", err)
-			}
-		} else {
-			if err := aws.CreateRoleWithTrustRelationsip("", params); err != nil {
-				return errors.Errorf("failed to create role, err: %v", err)
-			}
+	// Validate the requested steps before anything runs
+	steps, err := resolveSteps(params.Actions, params, infraState)
+	if err != nil {
+		return nil, err
+	}
+	if params.Resume {
+		log.Infof("[Info]: Resuming the onboarding, completed steps: %v", infraState.CompletedSteps)
+		if restartChangedPolicy(params, infraState, steps) {
+			log.Infof("[Info]: The settings of the chaos policy changed since the '%v' step completed, performing it again", stepPolicy)
 		}
-		if err := kubernetes.AnnotateServiceAccount(params, *clients); err != nil {
-			return errors.Errorf("failed to annotate experiment service account with role arn, err: %v", err)
+	} else {
+		if infraState.FailedStep != "" {
+			log.Warnf("[Warning]: The previous onboarding failed at step '%v', starting over. Use --resume to continue from the failed step", infraState.FailedStep)
 		}
+		// Only the requested steps are performed again, the outputs of the others are kept
+		infraState.Restart(stepNamesOf(steps))
+	}
+	if err := aws.ValidateIAMOptions(params.IAM); err != nil {
+		return nil, err
+	}
+	if err := aws.ValidateNaming(params); err != nil {
+		return nil, err
+	}
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return nil, err
+	}
 
-	case "only_install":
+	clients, err := newClients(params)
+	if err != nil {
+		return nil, err
+	}
 
-		if params.CreateNS {
-			if err := kubernetes.CreateNS(params.Infra.Namespace, *clients); err != nil {
-				return errors.Errorf("failed to create ns, err: %v", err)
-			}
+	if needsIssuer(steps) || touchesRole(steps) {
+		if err := resolveIssuer(&params, clients, needsIssuer(steps)); err != nil {
+			return nil, err
 		}
-		if err := register.RegisterInfra(params); err != nil {
-			return errors.Errorf("failed to register ChaosInfra, err: %v", err)
+	}
+	// A role created with the same name for another cluster must not be touched
+	if touchesRole(steps) {
+		if err := aws.CheckRoleCluster(params); err != nil {
+			return nil, err
 		}
+	}
 
-	case "install_with_provider":
+	o := &onboarding{
+		params:   params,
+		clients:  *clients,
+		store:    store,
+		state:    infraState,
+		roleName: roleName,
+	}
+	// Restore the outputs of the steps completed earlier
+	o.params.ProviderARN = infraState.ProviderARN
+	o.params.RoleARN = infraState.RoleARN
 
-		if params.CreateNS {
-			if err := kubernetes.CreateNS(params.Infra.Namespace, *clients); err != nil {
-				return errors.Errorf("failed to create ns, err: %v", err)
-			}
-		}
-		if err := register.RegisterInfra(params); err != nil {
-			return errors.Errorf("failed to register ChaosInfra, err: %v", err)
-		}
-		providerARN, err := aws.ConnectOIDCProvider(params)
-		if err != nil {
-			return errors.Errorf("failed to connect OIDC provider, err: %v", err)
-		}
-		params.ProviderARN = providerARN
-		if params.RoleName == "" {
-			if err := aws.PreparePolicyAndCreateRole(params); err != nil {
-				return errors.Errorf("failed to create policy and role, err: %v", err)
-			}
-		} else {
-			if err := aws.CreateRoleWithTrustRelationsip("", params); err != nil {
-				return errors.Errorf("failed to create role, err: %v", err)
-			}
+	for _, step := range steps {
+		if err := o.run(step); err != nil {
+			return infraState, err
 		}
+	}
+	return infraState, nil
+}
+
+// run will run the given step, unless it is already completed, and record its result in the state file
+func (o *onboarding) run(s step) error {
+	if o.state.IsCompleted(s.name) {
+		log.Infof("[Info]: Skipping the '%v' step as it is already completed", s.name)
+		return nil
+	}
+
+	err := s.run(o)
+	if err != nil {
+		o.state.Fail(s.name, err)
+	} else {
+		o.state.Complete(s.name)
+	}
+	if saveErr := o.store.Save(); saveErr != nil {
+		log.Warnf("[Warning]: %v", saveErr)
+	}
+	return err
+}
+
+func (o *onboarding) createNamespace() error {
+	if !o.params.CreateNS {
+		return nil
+	}
+	if err := kubernetes.CreateNS(o.params.Infra.Namespace, o.clients); err != nil {
+		return errors.Errorf("failed to create ns, err: %v", err)
+	}
+	return nil
+}
+
+func (o *onboarding) createEnvironment() error {
+	envID, err := register.CreateEnvironment(o.params)
+	if err != nil {
+		return err
+	}
+	o.state.EnvironmentID = envID
+	return nil
+}
+
+func (o *onboarding) registerInfra() error {
+	infraID, manifest, err := register.RegisterInfra(o.params)
+	if err != nil {
+		return errors.Errorf("failed to register ChaosInfra, err: %v", err)
+	}
+	o.state.InfraID = infraID
+	o.manifest = manifest
+	return nil
+}
 
-	case "only_provider":
-		providerARN, err := aws.ConnectOIDCProvider(params)
+func (o *onboarding) applyManifest() error {
+	// The manifest is not kept in the state file as it carries the infra token
+	if o.manifest == "" {
+		manifest, err := register.GetInfraManifest(o.state.InfraID, o.params)
 		if err != nil {
-			return errors.Errorf("failed to connect OIDC provider, err: %v", err)
+			return errors.Errorf("failed to get the chaos infra manifest, err: %v", err)
 		}
-		params.ProviderARN = providerARN
-		if params.RoleName == "" {
-			if err := aws.PreparePolicyAndCreateRole(params); err != nil {
-				return errors.Errorf("failed to create policy and role, err: %v", err)
-			}
-		} else {
-			if err := aws.CreateRoleWithTrustRelationsip("", params); err != nil {
-				return errors.Errorf("failed to create role, err: %v", err)
-			}
+		o.manifest = manifest
+	}
+	applied, err := register.ApplyChaosManifest(o.manifest, o.state.InfraID, o.params, o.clients)
+	o.state.AppliedObjects = applied
+	if err != nil {
+		return errors.Errorf("Failed to create chaos infra manifest: %v", err)
+	}
+	return nil
+}
+
+func (o *onboarding) waitForInfra() error {
+	if err := register.WaitForChaosInfra(o.state.InfraID, o.params); err != nil {
+		return errors.Errorf("failed to get the chaos infra in Connected state, err: %v", err)
+	}
+	return nil
+}
+
+func (o *onboarding) connectProvider() error {
+	providerARN, err := aws.ConnectOIDCProvider(o.params)
+	if err != nil {
+		return errors.Errorf("failed to connect OIDC provider, err: %v", err)
+	}
+	o.params.ProviderARN = providerARN
+	o.state.ProviderARN = providerARN
+	return nil
+}
+
+func (o *onboarding) createPolicy() error {
+	// No policy is created when an existing role is provided
+	if o.params.RoleName != "" {
+		return nil
+	}
+	guardrails, err := aws.CheckGuardrails(o.params)
+	if err != nil {
+		return errors.Errorf("failed to check the guardrails, err: %v", err)
+	}
+	for _, guardrail := range guardrails {
+		for _, issue := range guardrail.Issues {
+			log.Warnf("[Warning]: The guardrail '%v' doesn't protect everything it selects: %v", guardrail.Name, issue)
 		}
+	}
+	policies, err := aws.PreparePolicy(o.params)
+	if err != nil {
+		return errors.Errorf("failed to prepare policy, err: %v", err)
+	}
+	if o.params.IAM.InlinePolicy {
+		log.Info("[Info]: The policy is put inline in the role")
+		o.inlinePolicies = policies
+		o.state.PolicyARNs = nil
+		o.state.PolicyInputs = policyInputs(o.params)
+		return nil
+	}
+	policyARNs, err := aws.CreatePolicies(policies, o.params)
+	if err != nil {
+		return errors.Errorf("failed to create policy, err: %v", err)
+	}
+	o.state.PolicyARNs = policyARNs
+	o.state.PolicyInputs = policyInputs(o.params)
+	return nil
+}
 
-	case "only_annotate":
-		if err := kubernetes.AnnotateServiceAccount(params, *clients); err != nil {
-			return errors.Errorf("failed to annotate experiment service account with role arn, err: %v", err)
+func (o *onboarding) createRole() error {
+	if o.params.IAM.InlinePolicy && o.params.RoleName == "" && o.inlinePolicies == nil {
+		policies, err := aws.PreparePolicy(o.params)
+		if err != nil {
+			return errors.Errorf("failed to prepare policy, err: %v", err)
 		}
+		o.inlinePolicies = policies
+	}
+	if err := aws.CreateRoleWithTrustRelationsip(o.state.PolicyARNs, o.inlinePolicies, o.params); err != nil {
+		return errors.Errorf("failed to create role, err: %v", err)
+	}
+	roleARN, err := aws.GetRoleARN(o.params, o.roleName)
+	if err != nil {
+		return errors.Errorf("failed to retrive roleARN from given role name '%v', err: %v", o.roleName, err)
+	}
+	o.params.RoleARN = roleARN
+	o.state.RoleARN = roleARN
+	return nil
+}
 
-	default:
-		return errors.Errorf("invalid action: %s", params.Actions)
+func (o *onboarding) verifyTrust() error {
+	roleName := o.roleName
+	verification, err := aws.VerifyRoleTrust(roleName, o.params)
+	if err != nil {
+		return errors.Errorf("failed to verify the trust policy of role '%v', err: %v", roleName, err)
+	}
+	if !verification.CanAssume {
+		return errors.Errorf("the service account '%v' can't assume role '%v': %v", verification.Subject, roleName, strings.Join(verification.Reasons, "; "))
+	}
+	log.Infof("[Info]: The service account '%v' can assume role '%v'", verification.Subject, roleName)
+	return nil
+}
 
+func (o *onboarding) annotate() error {
+	if err := kubernetes.AnnotateServiceAccount(o.params, o.clients); err != nil {
+		return errors.Errorf("failed to annotate experiment service account with role arn, err: %v", err)
 	}
 	return nil
 }
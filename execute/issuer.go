@@ -0,0 +1,60 @@
+package execute
+
+import (
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/kubernetes"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// resolveIssuer will discover the OIDC issuer of the cluster, from the EKS cluster of the params or from the
+// api server of the clients, and set it as provider URL. A provider URL of the params must match the discovered
+// issuer, as no token of the cluster would match its OIDC provider. When the issuer can't be read from the api
+// server, the provider URL of the params is used unchecked, it is only an error when the issuer is required.
+func resolveIssuer(params *types.OnboardingParameters, clients *clients.ClientSets, required bool) error {
+
+	var issuer, source string
+	switch {
+	case strings.TrimSpace(params.EKSClusterName) != "":
+		var err error
+		if issuer, err = aws.EKSIssuer(*params); err != nil {
+			return err
+		}
+		source = "EKS cluster '" + params.EKSClusterName + "'"
+	case clients != nil:
+		var err error
+		if issuer, err = kubernetes.ClusterIssuer(*clients); err != nil {
+			if params.ProviderUrl != "" {
+				log.Warnf("[Warning]: The provider URL '%v' is not checked against the cluster, %v", params.ProviderUrl, err)
+				return nil
+			}
+			if required {
+				return errors.Errorf("failed to discover the OIDC issuer of the cluster, set --eks-cluster-name or --provider-url, err: %v", err)
+			}
+			return nil
+		}
+		source = "the cluster"
+	default:
+		if params.ProviderUrl == "" && required {
+			return errors.New("no OIDC issuer, set --eks-cluster-name or --provider-url")
+		}
+		return nil
+	}
+
+	if !strings.HasPrefix(issuer, "https://") {
+		return errors.Errorf("the OIDC issuer '%v' of %v is not an https URL, which IAM requires for an OIDC provider", issuer, source)
+	}
+	if params.ProviderUrl != "" {
+		if !aws.SameIssuer(params.ProviderUrl, issuer) {
+			return errors.Errorf("the provider URL '%v' doesn't match the OIDC issuer '%v' of %v, no token of the cluster would be accepted by its OIDC provider. Remove --provider-url to use the issuer of the cluster", params.ProviderUrl, issuer, source)
+		}
+		return nil
+	}
+	log.Infof("[Info]: The OIDC issuer of %v is '%v'", source, issuer)
+	params.ProviderUrl = issuer
+	return nil
+}
@@ -0,0 +1,475 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/kubernetes"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/register"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// The actions of a planned change
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionReuse  = "reuse"
+	actionSkip   = "skip"
+	actionWait   = "wait"
+	actionVerify = "verify"
+	actionDeny   = "deny"
+	actionAttach = "attach"
+	actionDelete = "delete"
+	actionAdopt  = "adopt"
+)
+
+// OnboardingPlan is the list of changes the onboarding of a chaos infra would make
+type OnboardingPlan struct {
+	InfraName string          `json:"infraName"`
+	Changes   []PlannedChange `json:"changes"`
+}
+
+// PlannedChange is a single mutation planned by a step of the onboarding
+type PlannedChange struct {
+	Step        string      `json:"step"`
+	Action      string      `json:"action"`
+	Target      string      `json:"target"`
+	Description string      `json:"description"`
+	Details     interface{} `json:"details,omitempty"`
+}
+
+// planner computes the changes of each step, it only performs read operations
+type planner struct {
+	params    types.OnboardingParameters
+	clients   clients.ClientSets
+	state     *state.InfraState
+	accountID string
+	role      string
+	plan      *OnboardingPlan
+	// policyARNs are the chaos policy documents planned by the policy step, the recorded ones when it is skipped
+	policyARNs []string
+}
+
+// Plan will compute every change the onboarding would make for the given parameters, without making any of them
+func Plan(params types.OnboardingParameters) (*OnboardingPlan, error) {
+	store, err := state.Load(params.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	infraState := store.Get(params)
+
+	steps, err := resolveSteps(params.Actions, params, infraState)
+	if err != nil {
+		return nil, err
+	}
+	// The plan doesn't save the state, a copy is restarted as Execute would
+	planned := *infraState
+	infraState = &planned
+	if !params.Resume {
+		infraState.Restart(stepNamesOf(steps))
+	} else {
+		restartChangedPolicy(params, infraState, steps)
+	}
+	if err := aws.ValidateIAMOptions(params.IAM); err != nil {
+		return nil, err
+	}
+	if err := aws.ValidateNaming(params); err != nil {
+		return nil, err
+	}
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := newClients(params)
+	if err != nil {
+		return nil, err
+	}
+	if needsIssuer(steps) || touchesRole(steps) {
+		if err := resolveIssuer(&params, clients, needsIssuer(steps)); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &planner{
+		params:  params,
+		clients: *clients,
+		state:   infraState,
+		role:    roleName,
+		plan:    &OnboardingPlan{InfraName: params.Infra.Name},
+	}
+	p.params.ProviderARN = infraState.ProviderARN
+	p.params.RoleARN = infraState.RoleARN
+	p.policyARNs = infraState.PolicyARNs
+
+	for _, s := range steps {
+		if infraState.IsCompleted(s.name) {
+			p.add(s.name, actionSkip, s.name, "already completed by a previous run", nil)
+			continue
+		}
+		if err := s.plan(p); err != nil {
+			return nil, errors.Errorf("failed to plan the '%v' step, err: %v", s.name, err)
+		}
+	}
+	return p.plan, nil
+}
+
+// Print will write the plan in a human readable form
+func (p *OnboardingPlan) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Plan for chaos infra '%v':\n", p.InfraName)
+	for _, change := range p.Changes {
+		fmt.Fprintf(w, "\n  [%v] %v %v\n      %v\n", change.Step, change.Action, change.Target, change.Description)
+		if change.Details == nil {
+			continue
+		}
+		details, err := json.MarshalIndent(change.Details, "      ", "  ")
+		if err != nil {
+			return errors.Errorf("failed to encode the details of step '%v', err: %v", change.Step, err)
+		}
+		fmt.Fprintf(w, "      %s\n", details)
+	}
+	return nil
+}
+
+// add will append a change to the plan
+func (p *planner) add(step, action, target, description string, details interface{}) {
+	p.plan.Changes = append(p.plan.Changes, PlannedChange{
+		Step:        step,
+		Action:      action,
+		Target:      target,
+		Description: description,
+		Details:     details,
+	})
+}
+
+// account will return the aws account ID, it is looked up only once
+func (p *planner) account() (string, error) {
+	if p.accountID != "" {
+		return p.accountID, nil
+	}
+	accountID, err := aws.GetAccountID(p.params)
+	if err != nil {
+		return "", err
+	}
+	p.accountID = accountID
+	return accountID, nil
+}
+
+// roleName will return the name of the chaos role
+func (p *planner) roleName() string {
+	return p.role
+}
+
+// roleARN will return the ARN of the chaos role, only the role created by the cli is under the IAM path
+func (p *planner) roleARN(accountID string) string {
+	if strings.TrimSpace(p.params.RoleName) != "" {
+		return aws.RoleARN(accountID, "", p.roleName())
+	}
+	return aws.RoleARN(accountID, p.params.IAM.Path, p.roleName())
+}
+
+func (p *planner) planEnvironment() error {
+	env := register.EnvironmentPayload(p.params)
+	p.add(stepEnvironment, actionCreate, "environment/"+env.Identifier, "create the chaos environment, an existing environment is reused", env)
+	return nil
+}
+
+func (p *planner) planRegister() error {
+	p.add(stepRegister, actionCreate, "infra/"+p.params.Infra.Name, "register the chaos infra in harness", register.InfraRequest(p.params))
+	return nil
+}
+
+func (p *planner) planWait() error {
+	timeout, delay := register.WaitSettings(p.params)
+	p.add(stepWait, actionWait, "infra/"+p.params.Infra.Name, fmt.Sprintf("wait up to %vs for the chaos infra to become active, checking every %vs", timeout, delay), nil)
+	return nil
+}
+
+func (p *planner) planNamespace() error {
+	target := "namespace/" + p.params.Infra.Namespace
+	if !p.params.CreateNS {
+		p.add(stepNamespace, actionSkip, target, "namespace creation is not requested", nil)
+		return nil
+	}
+	exists, err := kubernetes.NamespaceExists(p.params.Infra.Namespace, p.clients)
+	if err != nil {
+		return err
+	}
+	if exists {
+		p.add(stepNamespace, actionReuse, target, "the namespace already exists", nil)
+		return nil
+	}
+	p.add(stepNamespace, actionCreate, target, "create the chaos infra namespace", nil)
+	return nil
+}
+
+func (p *planner) planApply() error {
+	// The manifest is rendered by harness during registration, so it is only known for an already registered infra
+	if p.state.InfraID == "" {
+		p.add(stepApply, actionCreate, "namespace/"+p.params.Infra.Namespace,
+			"apply the chaos infra manifest rendered by harness on registration, the objects are known once the infra is registered", nil)
+		return nil
+	}
+	manifest, err := register.GetInfraManifest(p.state.InfraID, p.params)
+	if err != nil {
+		return err
+	}
+	objects, err := register.ManifestObjects(manifest, p.params)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		p.add(stepApply, actionCreate, fmt.Sprintf("%v/%v", obj.Kind, obj.Name), "apply the chaos infra manifest object", obj)
+	}
+	return nil
+}
+
+func (p *planner) planProvider() error {
+	accountID, err := p.account()
+	if err != nil {
+		return err
+	}
+	provider, err := aws.PlanOIDCProvider(p.params, accountID)
+	if err != nil {
+		return err
+	}
+	p.params.ProviderARN = provider.ARN
+	if provider.AlreadyExists && len(provider.Changes) != 0 {
+		p.add(stepOIDC, actionUpdate, provider.ARN, "the OIDC provider already exists, "+strings.Join(provider.Changes, " and "), provider)
+		return nil
+	}
+	if provider.AlreadyExists {
+		p.add(stepOIDC, actionReuse, provider.ARN, "the OIDC provider already exists", provider)
+		return nil
+	}
+	p.add(stepOIDC, actionCreate, provider.ARN, "create the OIDC provider", provider)
+	return nil
+}
+
+func (p *planner) planPolicy() error {
+	if strings.TrimSpace(p.params.RoleName) != "" {
+		p.add(stepPolicy, actionSkip, "policy", "no policy is created when an existing role is provided", nil)
+		return nil
+	}
+	guardrails, err := aws.CheckGuardrails(p.params)
+	if err != nil {
+		return err
+	}
+	for _, guardrail := range guardrails {
+		description := fmt.Sprintf("deny the chaos actions on the protected resources with %v statements", len(guardrail.Statements))
+		if len(guardrail.Issues) != 0 {
+			description += fmt.Sprintf(", %v issues", len(guardrail.Issues))
+		}
+		p.add(stepPolicy, actionDeny, "guardrail/"+guardrail.Name, description, guardrail)
+	}
+	policies, err := aws.PreparePolicy(p.params)
+	if err != nil {
+		return err
+	}
+	if p.params.IAM.InlinePolicy {
+		size, err := aws.PolicySize(policies[0])
+		if err != nil {
+			return err
+		}
+		policyName, err := aws.PolicyName(p.params, 0)
+		if err != nil {
+			return err
+		}
+		target := "role/" + p.roleName() + "/inline/" + policyName
+		p.add(stepPolicy, actionCreate, target, fmt.Sprintf("put the chaos policy inline in the role with %v characters", size), policies[0])
+		p.policyARNs = nil
+		return nil
+	}
+	updates, err := aws.PlanPolicyUpdates(policies, p.params)
+	if err != nil {
+		return err
+	}
+	p.policyARNs = nil
+	for i, update := range updates {
+		p.policyARNs = append(p.policyARNs, update.PolicyARN)
+		size, err := aws.PolicySize(policies[i])
+		if err != nil {
+			return err
+		}
+		if update.Adopt {
+			p.add(stepPolicy, actionAdopt, update.PolicyARN, "tag the policy created by an earlier version of this cli as managed", nil)
+		}
+		switch {
+		case !update.Exists:
+			description := fmt.Sprintf("create the chaos policy, document %v of %v with %v characters", i+1, len(policies), size)
+			p.add(stepPolicy, actionCreate, update.PolicyARN, description, policies[i])
+		case !update.Changed:
+			p.add(stepPolicy, actionSkip, update.PolicyARN, fmt.Sprintf("the policy is up to date at version %v", update.DefaultVersion), nil)
+		default:
+			description := fmt.Sprintf("create a new default version of the chaos policy replacing %v, document %v of %v with %v characters", update.DefaultVersion, i+1, len(policies), size)
+			if update.PruneVersion != "" {
+				description += ", deleting the oldest version " + update.PruneVersion
+			}
+			p.add(stepPolicy, actionUpdate, update.PolicyARN, description, policyChanges{
+				Added:   update.Added,
+				Removed: update.Removed,
+				Diff:    strings.Split(strings.TrimSuffix(update.Diff, "\n"), "\n"),
+			})
+		}
+	}
+	return nil
+}
+
+// policyChanges is the detail of a planned policy update
+type policyChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Diff    []string `json:"diff"`
+}
+
+// roleCreation is the detail of a planned role creation
+type roleCreation struct {
+	TrustPolicy json.RawMessage  `json:"trustPolicy"`
+	Settings    aws.RoleSettings `json:"settings"`
+}
+
+func (p *planner) planRole() error {
+	accountID, err := p.account()
+	if err != nil {
+		return err
+	}
+	if err := aws.CheckRoleCluster(p.params); err != nil {
+		return err
+	}
+	if p.params.ProviderARN == "" {
+		p.params.ProviderARN = aws.ProviderARN(accountID, p.params.ProviderUrl)
+	}
+	document, err := aws.TrustPolicyDocument(p.params)
+	if err != nil {
+		return err
+	}
+	trust := json.RawMessage(document)
+
+	roleName := p.roleName()
+	roleARN := p.roleARN(accountID)
+	if strings.TrimSpace(p.params.RoleName) != "" {
+		update, err := aws.PlanTrustUpdate(roleName, p.params)
+		if err != nil {
+			return err
+		}
+		if !update.Changed {
+			p.add(stepRole, actionSkip, roleARN, "the existing role already trusts the experiment service account", nil)
+			return p.planAttachments(roleName)
+		}
+		p.add(stepRole, actionUpdate, roleARN, "merge the statement for the experiment service account into the trust policy of the existing role", strings.Split(strings.TrimSuffix(update.Diff, "\n"), "\n"))
+		return p.planAttachments(roleName)
+	}
+
+	exists, managed, err := aws.RoleExists(p.params, roleName)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		p.add(stepRole, actionCreate, roleARN, "create the chaos role and attach the chaos policy", roleCreation{TrustPolicy: trust, Settings: aws.PlanRoleSettings(p.params)})
+		return p.planAttachments(roleName)
+	case !managed && !aws.AdoptableRole(roleName, p.params):
+		p.add(stepRole, actionCreate, roleARN, "the role already exists and was not created by this cli, creating it will fail", roleCreation{TrustPolicy: trust, Settings: aws.PlanRoleSettings(p.params)})
+		return nil
+	case !managed:
+		p.add(stepRole, actionAdopt, roleARN, "tag the role created by an earlier version of this cli as managed", nil)
+	}
+
+	// The role created by an earlier run is adopted, its documents are reconciled with the planned ones
+	update, err := aws.PlanTrustUpdate(roleName, p.params)
+	if err != nil {
+		return err
+	}
+	if update.Changed {
+		p.add(stepRole, actionUpdate, roleARN, "merge the statement for the experiment service account into the trust policy of the existing chaos role", strings.Split(strings.TrimSuffix(update.Diff, "\n"), "\n"))
+	} else {
+		p.add(stepRole, actionReuse, roleARN, "the chaos role already exists and trusts the experiment service account", nil)
+	}
+	changes, err := aws.PlanRoleReconcile(roleName, p.params)
+	if err != nil {
+		return err
+	}
+	if len(changes) != 0 {
+		p.add(stepRole, actionUpdate, roleARN, "update the settings of the existing chaos role to match the IAM options", changes)
+	}
+	for _, policyARN := range p.policyARNs {
+		p.add(stepRole, actionAttach, policyARN, "attach the chaos policy document to the role, if not attached yet", nil)
+	}
+	stale, err := aws.StalePolicyARNs(roleName, p.policyARNs, p.params)
+	if err != nil {
+		return err
+	}
+	for _, policyARN := range stale {
+		p.add(stepRole, actionDelete, policyARN, "detach and delete the chaos policy document which is no longer generated", nil)
+	}
+	if !p.params.IAM.InlinePolicy {
+		inline, err := aws.InlineChaosPolicies(roleName, p.params)
+		if err != nil {
+			return err
+		}
+		for _, policyName := range inline {
+			p.add(stepRole, actionDelete, "role/"+roleName+"/inline/"+policyName, "delete the chaos policy put inline in the role, it is replaced by the managed policies", nil)
+		}
+	}
+	return p.planAttachments(roleName)
+}
+
+// planAttachments will plan the attachment of the managed policies of the IAM options to the role
+func (p *planner) planAttachments(roleName string) error {
+	attachments, err := aws.PlanPolicyAttachments(roleName, p.params)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		switch {
+		case attachment.PreExisting:
+			p.add(stepRole, actionSkip, attachment.PolicyARN, "the policy is already attached to the role, it is left attached on deregister", nil)
+		case attachment.Attached:
+			p.add(stepRole, actionSkip, attachment.PolicyARN, "the policy is already attached to the role", nil)
+		default:
+			p.add(stepRole, actionAttach, attachment.PolicyARN, "attach the managed policy to the role, it is detached on deregister", nil)
+		}
+	}
+	return nil
+}
+
+func (p *planner) planVerify() error {
+	accountID, err := p.account()
+	if err != nil {
+		return err
+	}
+	subject := aws.ServiceAccountSubject(p.params.Infra.Namespace, p.params.ExperimentServiceAccountName)
+	p.add(stepVerify, actionVerify, p.roleARN(accountID), "verify that the service account '"+subject+"' can assume the role", nil)
+	return nil
+}
+
+func (p *planner) planAnnotation() error {
+	accountID, err := p.account()
+	if err != nil {
+		return err
+	}
+	roleARN := p.roleARN(accountID)
+	target := fmt.Sprintf("serviceaccount/%v", p.params.ExperimentServiceAccountName)
+
+	current, err := kubernetes.GetRoleAnnotation(p.params, p.clients)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	annotation := map[string]string{types.RoleARNAnnotation: roleARN}
+	switch {
+	case k8serrors.IsNotFound(err):
+		p.add(stepAnnotate, actionUpdate, target, "the service account does not exist yet, it is expected to be created by the chaos infra", annotation)
+	case current == roleARN:
+		p.add(stepAnnotate, actionSkip, target, "the service account is already annotated", annotation)
+	default:
+		p.add(stepAnnotate, actionUpdate, target, "annotate the experiment service account with the roleARN", annotation)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package execute
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/kubernetes"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/register"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// The results of a status check
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+)
+
+// StatusCheck is the result of a single health check of an onboarded infra
+type StatusCheck struct {
+	Component string `json:"component"`
+	Check     string `json:"check"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// InfraStatus is the end to end health of an onboarded infra
+type InfraStatus struct {
+	InfraName string                      `json:"infraName"`
+	InfraID   string                      `json:"infraID,omitempty"`
+	Infra     *types.ChaosInfra           `json:"infra,omitempty"`
+	Workloads []kubernetes.WorkloadStatus `json:"workloads,omitempty"`
+	RoleARN   string                      `json:"roleARN,omitempty"`
+	Role      *aws.RoleStatus             `json:"role,omitempty"`
+	Checks    []StatusCheck               `json:"checks"`
+	Healthy   bool                        `json:"healthy"`
+}
+
+// Status will report the health of an onboarded infra across harness, the cluster and aws
+func Status(params types.OnboardingParameters, infraID string) (*InfraStatus, error) {
+	clients, err := newClients(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveIssuer(&params, clients, false); err != nil {
+		return nil, err
+	}
+
+	status := &InfraStatus{InfraName: params.Infra.Name, InfraID: infraID}
+
+	if status.InfraID == "" {
+		store, err := state.Load(params.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		status.InfraID = store.Get(params).InfraID
+	}
+	if status.InfraID == "" {
+		id, err := register.GetInfraID(params)
+		if err != nil {
+			status.add("harness", "registered", statusDegraded, err.Error())
+		}
+		status.InfraID = id
+	}
+
+	if status.InfraID != "" {
+		status.checkHarness(params)
+		status.checkWorkloads(params, *clients)
+	}
+	status.checkRole(params, *clients)
+
+	status.Healthy = true
+	for _, check := range status.Checks {
+		if check.Status != statusOK {
+			status.Healthy = false
+		}
+	}
+	return status, nil
+}
+
+// Print will write the status checks as a table
+func (s *InfraStatus) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Status of chaos infra '%v' (%v):\n\n", s.InfraName, s.InfraID)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tCHECK\tSTATUS\tDETAIL")
+	for _, check := range s.Checks {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", check.Component, check.Check, check.Status, check.Detail)
+	}
+	return tw.Flush()
+}
+
+// add will append a check to the status
+func (s *InfraStatus) add(component, check, status, detail string) {
+	s.Checks = append(s.Checks, StatusCheck{Component: component, Check: check, Status: status, Detail: detail})
+}
+
+// result will return the check status for the given condition
+func result(healthy bool) string {
+	if healthy {
+		return statusOK
+	}
+	return statusDegraded
+}
+
+func (s *InfraStatus) checkHarness(params types.OnboardingParameters) {
+	infra, err := register.GetChaosInfra(s.InfraID, params)
+	if err != nil {
+		s.add("harness", "registered", statusDegraded, err.Error())
+		return
+	}
+	s.Infra = &infra
+	s.add("harness", "registered", result(infra.InfraID != "" && !infra.IsRemoved), "version "+infra.Version)
+	s.add("harness", "active", result(infra.IsActive), "updated at "+formatTimestamp(infra.UpdatedAt))
+	s.add("harness", "confirmed", result(infra.IsInfraConfirmed), "last experiment run at "+formatTimestamp(infra.LastWorkflowTimestamp))
+}
+
+func (s *InfraStatus) checkWorkloads(params types.OnboardingParameters, clients clients.ClientSets) {
+	manifest, err := register.GetInfraManifest(s.InfraID, params)
+	if err != nil {
+		s.add("cluster", "workloads", statusDegraded, err.Error())
+		return
+	}
+	objects, err := register.ManifestObjects(manifest, params)
+	if err != nil {
+		s.add("cluster", "workloads", statusDegraded, err.Error())
+		return
+	}
+	workloads, err := kubernetes.GetWorkloadStatus(objects, clients)
+	if err != nil {
+		s.add("cluster", "workloads", statusDegraded, err.Error())
+		return
+	}
+	s.Workloads = workloads
+	for _, workload := range workloads {
+		if !workload.Found {
+			s.add("cluster", "deployment/"+workload.Name, statusDegraded, "not found")
+			continue
+		}
+		var notReady []string
+		for _, pod := range workload.Pods {
+			if !pod.Ready {
+				notReady = append(notReady, pod.Name+" ("+pod.Phase+")")
+			}
+		}
+		detail := fmt.Sprintf("%v/%v ready", workload.Ready, workload.Wanted)
+		if len(notReady) != 0 {
+			detail += ", not ready: " + strings.Join(notReady, ", ")
+		}
+		s.add("cluster", "deployment/"+workload.Name, result(workload.Ready >= workload.Wanted && len(notReady) == 0), detail)
+	}
+}
+
+func (s *InfraStatus) checkRole(params types.OnboardingParameters, clients clients.ClientSets) {
+	roleARN, err := kubernetes.GetRoleAnnotation(params, clients)
+	if err != nil {
+		s.add("cluster", "serviceaccount/"+params.ExperimentServiceAccountName, statusDegraded, err.Error())
+		return
+	}
+	if roleARN == "" {
+		s.add("cluster", "serviceaccount/"+params.ExperimentServiceAccountName, statusDegraded, "no "+types.RoleARNAnnotation+" annotation")
+		return
+	}
+	s.RoleARN = roleARN
+	s.add("cluster", "serviceaccount/"+params.ExperimentServiceAccountName, statusOK, roleARN)
+
+	roleName := roleARN[strings.LastIndex(roleARN, "/")+1:]
+	role, err := aws.InspectRole(roleName, params)
+	if err != nil {
+		s.add("aws", "role", statusDegraded, err.Error())
+		return
+	}
+	s.Role = &role
+	if !role.Exists {
+		s.add("aws", "role", statusDegraded, "role '"+roleName+"' does not exist")
+		return
+	}
+	s.add("aws", "role", statusOK, roleName)
+	s.add("aws", "trusts provider", result(role.TrustsProvider), role.ProviderARN)
+	trustDetail := aws.ServiceAccountSubject(params.Infra.Namespace, params.ExperimentServiceAccountName)
+	if len(role.TrustIssues) != 0 {
+		trustDetail += ": " + strings.Join(role.TrustIssues, "; ")
+	}
+	s.add("aws", "trusts service account", result(role.TrustsServiceAccount), trustDetail)
+	detail := "covers " + strings.Trim(params.Resources+","+params.Faults, ",")
+	if len(role.MissingActions) != 0 {
+		detail = "missing " + strings.Join(role.MissingActions, ", ")
+	}
+	s.add("aws", "policy", result(len(role.MissingActions) == 0), detail)
+}
+
+// formatTimestamp will format the epoch milliseconds returned by harness
+func formatTimestamp(timestamp string) string {
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || millis == 0 {
+		return "never"
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
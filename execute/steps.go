@@ -0,0 +1,213 @@
+package execute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// The steps of the onboarding, each step records its outputs in the state file
+const (
+	stepNamespace   = "namespace"
+	stepEnvironment = "environment"
+	stepRegister    = "register"
+	stepApply       = "apply"
+	stepWait        = "wait"
+	stepOIDC        = "oidc"
+	stepPolicy      = "policy"
+	stepRole        = "role"
+	stepVerify      = "verify"
+	stepAnnotate    = "annotate"
+)
+
+// step is a named, individually addressable part of the onboarding
+type step struct {
+	name string
+	// dependsOn returns the steps whose outputs are needed by this step
+	dependsOn func(params types.OnboardingParameters) []string
+	run       func(o *onboarding) error
+	plan      func(p *planner) error
+}
+
+// pipeline is the list of all the steps in the order they are performed
+var pipeline = []step{
+	{name: stepNamespace, dependsOn: noDependency, run: (*onboarding).createNamespace, plan: (*planner).planNamespace},
+	{name: stepEnvironment, dependsOn: noDependency, run: (*onboarding).createEnvironment, plan: (*planner).planEnvironment},
+	{name: stepRegister, dependsOn: dependsOn(stepEnvironment), run: (*onboarding).registerInfra, plan: (*planner).planRegister},
+	{name: stepApply, dependsOn: dependsOn(stepRegister), run: (*onboarding).applyManifest, plan: (*planner).planApply},
+	{name: stepWait, dependsOn: dependsOn(stepApply), run: (*onboarding).waitForInfra, plan: (*planner).planWait},
+	{name: stepOIDC, dependsOn: noDependency, run: (*onboarding).connectProvider, plan: (*planner).planProvider},
+	{name: stepPolicy, dependsOn: noDependency, run: (*onboarding).createPolicy, plan: (*planner).planPolicy},
+	{name: stepRole, dependsOn: roleDependencies, run: (*onboarding).createRole, plan: (*planner).planRole},
+	{name: stepVerify, dependsOn: noDependency, run: (*onboarding).verifyTrust, plan: (*planner).planVerify},
+	{name: stepAnnotate, dependsOn: noDependency, run: (*onboarding).annotate, plan: (*planner).planAnnotation},
+}
+
+// actionAliases are the predefined sets of steps accepted by --actions
+var actionAliases = map[string][]string{
+	"all":                   {stepNamespace, stepEnvironment, stepRegister, stepApply, stepWait, stepOIDC, stepPolicy, stepRole, stepVerify, stepAnnotate},
+	"only_install":          {stepNamespace, stepEnvironment, stepRegister, stepApply, stepWait},
+	"install_with_provider": {stepNamespace, stepEnvironment, stepRegister, stepApply, stepWait, stepOIDC, stepPolicy, stepRole, stepVerify},
+	"only_provider":         {stepOIDC, stepPolicy, stepRole, stepVerify},
+	"only_annotate":         {stepAnnotate},
+}
+
+func noDependency(params types.OnboardingParameters) []string {
+	return nil
+}
+
+func dependsOn(steps ...string) func(params types.OnboardingParameters) []string {
+	return func(params types.OnboardingParameters) []string {
+		return steps
+	}
+}
+
+// roleDependencies needs the chaos policy only when a new role is created
+func roleDependencies(params types.OnboardingParameters) []string {
+	if strings.TrimSpace(params.RoleName) != "" {
+		return []string{stepOIDC}
+	}
+	return []string{stepOIDC, stepPolicy}
+}
+
+// touchesRole will check if any of the steps changes the chaos role or its policies
+func touchesRole(steps []step) bool {
+	for _, s := range steps {
+		if s.name == stepPolicy || s.name == stepRole || s.name == stepAnnotate {
+			return true
+		}
+	}
+	return false
+}
+
+// needsIssuer will check if any of the steps needs the OIDC issuer of the cluster
+func needsIssuer(steps []step) bool {
+	for _, s := range steps {
+		if s.name == stepOIDC || s.name == stepRole || s.name == stepVerify {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSteps will parse the comma separated steps and aliases of --actions and return the steps in
+// the order they are performed. Every dependency must either be requested or completed by a previous run.
+func resolveSteps(actions string, params types.OnboardingParameters, infraState *state.InfraState) ([]step, error) {
+
+	requested := map[string]bool{}
+	for _, action := range strings.Split(actions, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" {
+			continue
+		}
+		if alias, ok := actionAliases[action]; ok {
+			for _, name := range alias {
+				requested[name] = true
+			}
+			continue
+		}
+		if _, ok := findStep(action); !ok {
+			return nil, errors.Errorf("invalid action: %s, supported steps are %v and aliases are %v", action, stepNames(), aliasNames())
+		}
+		requested[action] = true
+	}
+	if len(requested) == 0 {
+		return nil, errors.Errorf("no action provided, supported steps are %v and aliases are %v", stepNames(), aliasNames())
+	}
+
+	var steps []step
+	var missing []string
+	for _, s := range pipeline {
+		if !requested[s.name] {
+			continue
+		}
+		for _, dependency := range s.dependsOn(params) {
+			if !requested[dependency] && !infraState.IsCompleted(dependency) {
+				missing = append(missing, "'"+s.name+"' requires '"+dependency+"'")
+			}
+		}
+		steps = append(steps, s)
+	}
+	if len(missing) != 0 {
+		return nil, errors.Errorf("invalid actions '%v': %v", actions, strings.Join(missing, ", "))
+	}
+	return steps, nil
+}
+
+// policyInputs will return a digest of the settings the chaos policy is generated from
+func policyInputs(params types.OnboardingParameters) string {
+	data, _ := json.Marshal(struct {
+		Resources     string
+		Faults        string
+		PolicyCatalog string
+		Scope         types.PolicyScope
+		Guardrails    []types.Guardrail
+		Path          string
+		Inline        bool
+	}{params.Resources, params.Faults, params.PolicyCatalog, params.Scope, params.Guardrails, params.IAM.Path, params.IAM.InlinePolicy})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// restartChangedPolicy will perform the policy step again on resume, along with the role step attaching its
+// documents, when the settings of the chaos policy changed since it completed
+func restartChangedPolicy(params types.OnboardingParameters, infraState *state.InfraState, steps []step) bool {
+	requested := stepNamesOf(steps)
+	if !contains(requested, stepPolicy) || !infraState.IsCompleted(stepPolicy) || infraState.PolicyInputs == policyInputs(params) {
+		return false
+	}
+	restarted := []string{stepPolicy}
+	if contains(requested, stepRole) {
+		restarted = append(restarted, stepRole)
+	}
+	infraState.Restart(restarted)
+	return true
+}
+
+// contains will check if the list holds the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stepNamesOf will return the names of the given steps
+func stepNamesOf(steps []step) []string {
+	var result []string
+	for _, s := range steps {
+		result = append(result, s.name)
+	}
+	return result
+}
+
+// findStep will return the step with the given name
+func findStep(name string) (step, bool) {
+	for _, s := range pipeline {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return step{}, false
+}
+
+// stepNames will return the names of all the steps in order
+func stepNames() []string {
+	var names []string
+	for _, s := range pipeline {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// aliasNames will return the names of all the aliases
+func aliasNames() []string {
+	return []string{"all", "only_install", "install_with_provider", "only_provider", "only_annotate"}
+}
@@ -0,0 +1,51 @@
+package execute
+
+import (
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// UpdateTrust will add or remove the trust subjects of the chaos role, without recreating it. The trust policy is
+// only planned in dry run mode.
+func UpdateTrust(params types.OnboardingParameters, subjects []types.TrustSubject, remove bool) (aws.TrustUpdate, error) {
+
+	// The trust commands don't connect to the cluster, the issuer is only discovered from an EKS cluster
+	if err := resolveIssuer(&params, nil, false); err != nil {
+		return aws.TrustUpdate{}, err
+	}
+
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return aws.TrustUpdate{}, err
+	}
+	if err := aws.CheckRoleCluster(params); err != nil {
+		return aws.TrustUpdate{}, err
+	}
+	update, err := aws.PlanTrustSubjects(roleName, subjects, remove, params)
+	if err != nil {
+		return update, err
+	}
+	if !update.Changed {
+		log.Infof("[Info]: The trust policy of role '%v' is already up to date", roleName)
+		return update, nil
+	}
+	if params.Dryrun {
+		return update, nil
+	}
+	log.Infof("[Info]: Updating the trust policy of role '%v':\n%v", roleName, update.Diff)
+	return update, aws.ApplyTrustUpdate(update, params)
+}
+
+// ListTrust will return the service accounts trusted by the chaos role
+func ListTrust(params types.OnboardingParameters) ([]aws.TrustedSubject, error) {
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return nil, err
+	}
+	document, err := aws.GetTrustPolicy(roleName, params)
+	if err != nil {
+		return nil, err
+	}
+	return aws.ListTrustSubjects(document)
+}
@@ -0,0 +1,274 @@
+package aws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+const (
+	// attachmentTagPrefix is the prefix of the role tags recording the managed policies attached by this cli, the
+	// key ends with a hash of the infra namespace and policy ARN and the value is the policy ARN
+	attachmentTagPrefix = "hce.harness.io/attached-policy-"
+	// maxInlinePolicySize is the maximum number of characters of all the inline policies of a role, without whitespace
+	maxInlinePolicySize = 10240
+)
+
+// attachmentTagKey will return the key of the role tag recording that the policy is attached for the infra namespace
+func attachmentTagKey(namespace, policyARN string) string {
+	sum := sha256.Sum256([]byte(namespace + "\n" + policyARN))
+	return attachmentTagPrefix + hex.EncodeToString(sum[:8])
+}
+
+// PolicyAttachment is the state of a managed policy of the IAM options on the chaos role. A policy attached without
+// the record of this cli is pre-existing, it is never detached by this cli.
+type PolicyAttachment struct {
+	PolicyARN   string `json:"policyARN"`
+	Attached    bool   `json:"attached"`
+	Recorded    bool   `json:"recorded"`
+	PreExisting bool   `json:"preExisting"`
+	tagKey      string
+}
+
+// PlanPolicyAttachments will return the state of the managed policies of the IAM options on the role, the role
+// doesn't have to exist yet
+func PlanPolicyAttachments(roleName string, params types.OnboardingParameters) ([]PolicyAttachment, error) {
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	return planAttachments(iam.New(sess), roleName, params)
+}
+
+// planAttachments will compare the managed policies of the IAM options with the ones attached to the role
+func planAttachments(svc *iam.IAM, roleName string, params types.OnboardingParameters) ([]PolicyAttachment, error) {
+
+	policyARNs := splitNames(params.IAM.ManagedPolicyARNs)
+	if len(policyARNs) == 0 {
+		return nil, nil
+	}
+	owners := map[string]int{}
+	recorded := map[string]bool{}
+	attached := map[string]bool{}
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	switch {
+	case err == nil:
+		for _, tag := range role.Role.Tags {
+			if strings.HasPrefix(aws.StringValue(tag.Key), attachmentTagPrefix) {
+				owners[aws.StringValue(tag.Value)]++
+				recorded[aws.StringValue(tag.Key)] = true
+			}
+		}
+		if attached, err = attachedPolicyARNs(svc, roleName); err != nil {
+			return nil, err
+		}
+	case !isNotFound(err):
+		return nil, errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+
+	var attachments []PolicyAttachment
+	for _, policyARN := range policyARNs {
+		key := attachmentTagKey(params.Infra.Namespace, policyARN)
+		attachments = append(attachments, PolicyAttachment{
+			PolicyARN:   policyARN,
+			Attached:    attached[policyARN],
+			Recorded:    recorded[key],
+			PreExisting: attached[policyARN] && owners[policyARN] == 0,
+			tagKey:      key,
+		})
+	}
+	return attachments, nil
+}
+
+// AttachManagedPolicies will attach the managed policies of the IAM options to the role. The attachments are
+// recorded in tags of the role for the infra namespace, a pre-existing attachment is left out of the record.
+func AttachManagedPolicies(svc *iam.IAM, roleName string, params types.OnboardingParameters) error {
+
+	attachments, err := planAttachments(svc, roleName, params)
+	if err != nil {
+		return err
+	}
+
+	var tags []*iam.Tag
+	for _, attachment := range attachments {
+		if attachment.PreExisting {
+			log.Infof("[Info]: The policy '%v' is already attached to role '%v', it is left attached on deregister", attachment.PolicyARN, roleName)
+			continue
+		}
+		if !attachment.Recorded {
+			tags = append(tags, &iam.Tag{Key: aws.String(attachment.tagKey), Value: aws.String(attachment.PolicyARN)})
+		}
+	}
+
+	// The attachments are recorded first, so a policy attached by this cli is never taken for a pre-existing one
+	if len(tags) != 0 {
+		role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+		}
+		if len(role.Role.Tags)+len(tags) > maxTags {
+			return errors.Errorf("the role '%v' has %v tags, recording the %v attached policies exceeds the limit of %v tags of a role", roleName, len(role.Role.Tags), len(tags), maxTags)
+		}
+		if _, err := svc.TagRole(&iam.TagRoleInput{RoleName: aws.String(roleName), Tags: tags}); err != nil {
+			return iamError("tag role '"+roleName+"'", err)
+		}
+	}
+	for _, attachment := range attachments {
+		if attachment.Attached {
+			if !attachment.PreExisting {
+				log.Infof("[Info]: The policy '%v' is already attached to role '%v'", attachment.PolicyARN, roleName)
+			}
+			continue
+		}
+		if _, err := svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
+			PolicyArn: aws.String(attachment.PolicyARN),
+			RoleName:  aws.String(roleName),
+		}); err != nil {
+			return iamError("attach policy '"+attachment.PolicyARN+"'", err)
+		}
+		log.Infof("[Info]: The policy '%v' is attached to role '%v'", attachment.PolicyARN, roleName)
+	}
+	return nil
+}
+
+// DetachManagedPolicies will detach the managed policies attached to the role by this cli for the infra namespace.
+// A policy also attached for another namespace stays attached, only the record of the namespace is removed.
+func DetachManagedPolicies(svc *iam.IAM, roleName, namespace string) error {
+
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	owners := map[string]int{}
+	var owned []*iam.Tag
+	for _, tag := range role.Role.Tags {
+		key, policyARN := aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+		if !strings.HasPrefix(key, attachmentTagPrefix) {
+			continue
+		}
+		owners[policyARN]++
+		if key == attachmentTagKey(namespace, policyARN) {
+			owned = append(owned, tag)
+		}
+	}
+
+	var keys []*string
+	for _, tag := range owned {
+		policyARN := aws.StringValue(tag.Value)
+		keys = append(keys, tag.Key)
+		if owners[policyARN] > 1 {
+			log.Infof("[Info]: The policy '%v' stays attached to role '%v' as it is attached for other namespaces", policyARN, roleName)
+			continue
+		}
+		if _, err := svc.DetachRolePolicy(&iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(policyARN),
+			RoleName:  aws.String(roleName),
+		}); err != nil && !isNotFound(err) {
+			return errors.Errorf("failed to detach policy '%v' from role '%v', err: %v", policyARN, roleName, err)
+		}
+		log.Infof("[Info]: The policy '%v' is detached from role '%v'", policyARN, roleName)
+	}
+	if len(keys) != 0 {
+		if _, err := svc.UntagRole(&iam.UntagRoleInput{RoleName: aws.String(roleName), TagKeys: keys}); err != nil {
+			return errors.Errorf("failed to untag role '%v', err: %v", roleName, err)
+		}
+	}
+	return nil
+}
+
+// attachedPolicyARNs will return the ARNs of the managed policies attached to the role
+func attachedPolicyARNs(svc *iam.IAM, roleName string) (map[string]bool, error) {
+	attached := map[string]bool{}
+	err := svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				attached[aws.StringValue(policy.PolicyArn)] = true
+			}
+			return true
+		})
+	if err != nil {
+		return nil, errors.Errorf("failed to list the policies attached to role '%v', err: %v", roleName, err)
+	}
+	return attached, nil
+}
+
+// putInlinePolicy will put the chaos policy inline in the role, replacing its previous document
+func putInlinePolicy(svc *iam.IAM, roleName, policyName string, policy Policy) error {
+
+	policyDoc, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Errorf("failed to prepare policy JSON, err: %v", err)
+	}
+	if _, err := svc.PutRolePolicy(&iam.PutRolePolicyInput{
+		PolicyDocument: aws.String(string(policyDoc)),
+		PolicyName:     aws.String(policyName),
+		RoleName:       aws.String(roleName),
+	}); err != nil {
+		return iamError("put inline policy '"+policyName+"' in role '"+roleName+"'", err)
+	}
+	log.Infof("[Info]: The policy '%v' is put inline in role '%v'", policyName, roleName)
+	return nil
+}
+
+// deleteInlinePolicies will delete the chaos policies put inline in the role
+func deleteInlinePolicies(svc *iam.IAM, roleName, policyName string) error {
+
+	names, err := inlineChaosPolicies(svc, roleName, policyName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := svc.DeleteRolePolicy(&iam.DeleteRolePolicyInput{PolicyName: aws.String(name), RoleName: aws.String(roleName)}); err != nil {
+			return errors.Errorf("failed to delete the inline policy '%v' of role '%v', err: %v", name, roleName, err)
+		}
+		log.Infof("[Info]: The inline policy '%v' of role '%v' is deleted", name, roleName)
+	}
+	return nil
+}
+
+// InlineChaosPolicies will return the names of the chaos policies put inline in the role, the role doesn't have
+// to exist yet
+func InlineChaosPolicies(roleName string, params types.OnboardingParameters) ([]string, error) {
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	policyName, err := PolicyName(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	return inlineChaosPolicies(iam.New(sess), roleName, policyName)
+}
+
+// inlineChaosPolicies will return the names of the inline policies of the role which are chaos policy documents
+func inlineChaosPolicies(svc *iam.IAM, roleName, policyName string) ([]string, error) {
+
+	inline, err := svc.ListRolePolicies(&iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("failed to list the inline policies of role '%v', err: %v", roleName, err)
+	}
+	names := map[string]bool{}
+	for _, name := range inline.PolicyNames {
+		names[aws.StringValue(name)] = true
+	}
+	var chaos []string
+	for i := 0; i < maxAttachedPolicies; i++ {
+		if name := documentName(policyName, i); names[name] {
+			chaos = append(chaos, name)
+		}
+	}
+	return chaos, nil
+}
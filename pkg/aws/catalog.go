@@ -0,0 +1,543 @@
+package aws
+
+import (
+	"embed"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// builtinCatalog holds the policy of each resource group accepted by --resources and each fault accepted by --faults
+//
+//go:embed catalog/*.yaml
+var builtinCatalog embed.FS
+
+// builtinSource is the source reported for the resource groups of the built-in catalog
+const builtinSource = "built-in"
+
+var (
+	groupNamePattern    = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	actionPattern       = regexp.MustCompile(`^[a-zA-Z0-9-]+:[a-zA-Z0-9*?]+$|^\*$`)
+	resourceTypePattern = regexp.MustCompile(`^[a-z0-9-]+:[a-zA-Z0-9-]+$`)
+)
+
+// catalogFile is the schema of a policy catalog file
+type catalogFile struct {
+	Groups  []catalogGroup   `json:"groups,omitempty"`
+	Faults  []catalogGroup   `json:"faults,omitempty"`
+	Scoping []catalogScoping `json:"scoping,omitempty"`
+}
+
+// catalogGroup is a resource group or a fault of a policy catalog file
+type catalogGroup struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Statements  []catalogStatement `json:"statements"`
+}
+
+// catalogStatement is a policy statement of a resource group
+type catalogStatement struct {
+	Effect     string                            `json:"effect"`
+	Actions    []string                          `json:"actions"`
+	Resources  []string                          `json:"resources,omitempty"`
+	Conditions map[string]map[string]interface{} `json:"conditions,omitempty"`
+}
+
+// catalogScoping are the resource types and condition keys supported by the actions, used to scope them
+type catalogScoping struct {
+	Actions       []string `json:"actions"`
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+	ConditionKeys []string `json:"conditionKeys,omitempty"`
+}
+
+// PolicyGroup is a resource group or a fault of the policy catalog along with the statements it needs
+type PolicyGroup struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Source      string      `json:"source"`
+	Statements  []Statement `json:"statements"`
+}
+
+// Registry is the policy catalog, the built-in resource groups and faults along with the ones added or overridden by the user
+type Registry struct {
+	groups  map[string]PolicyGroup
+	faults  map[string]PolicyGroup
+	scoping map[string]catalogScoping
+}
+
+// The kinds of entries of the policy catalog
+const (
+	kindGroup = "group"
+	kindFault = "fault"
+)
+
+// ResourceGroup is a resource group or a fault of the catalog along with its number of actions
+type ResourceGroup struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+	Actions     int    `json:"actions"`
+}
+
+// ActionSource is an action of the chaos policy along with the resource groups and faults which need it
+type ActionSource struct {
+	Action         string   `json:"action"`
+	ResourceGroups []string `json:"resourceGroups,omitempty"`
+	Faults         []string `json:"faults,omitempty"`
+}
+
+// NewRegistry will load the built-in catalog and the catalog files of the given directory, if any. The resource
+// groups and faults of the directory are added to the catalog and replace the built-in ones with the same name.
+func NewRegistry(catalogDir string) (*Registry, error) {
+
+	registry := &Registry{groups: map[string]PolicyGroup{}, faults: map[string]PolicyGroup{}, scoping: map[string]catalogScoping{}}
+
+	builtin, err := builtinCatalog.ReadDir("catalog")
+	if err != nil {
+		return nil, errors.Errorf("failed to read the built-in policy catalog, err: %v", err)
+	}
+	for _, entry := range builtin {
+		data, err := builtinCatalog.ReadFile("catalog/" + entry.Name())
+		if err != nil {
+			return nil, errors.Errorf("failed to read the built-in policy catalog, err: %v", err)
+		}
+		catalog, err := parseCatalog(entry.Name(), data)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.add(catalog, builtinSource, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if catalogDir == "" {
+		return registry, nil
+	}
+	files, err := catalogFiles(catalogDir)
+	if err != nil {
+		return nil, err
+	}
+	defined := map[string]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Errorf("failed to read policy catalog file '%v', err: %v", file, err)
+		}
+		catalog, err := parseCatalog(file, data)
+		if err != nil {
+			return nil, err
+		}
+		for kind, groups := range map[string][]catalogGroup{kindGroup: catalog.Groups, kindFault: catalog.Faults} {
+			for _, group := range groups {
+				if previous, ok := defined[kind+"/"+group.Name]; ok {
+					return nil, errors.Errorf("invalid policy catalog file '%v', %v '%v': already defined in '%v'", file, kind, group.Name, previous)
+				}
+				defined[kind+"/"+group.Name] = file
+			}
+		}
+		if err := registry.add(catalog, file, true); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// catalogFiles will return the yaml and json files of the catalog directory, sorted by name
+func catalogFiles(catalogDir string) ([]string, error) {
+	entries, err := os.ReadDir(catalogDir)
+	if err != nil {
+		return nil, errors.Errorf("failed to read the policy catalog directory '%v', err: %v", catalogDir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(catalogDir, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseCatalog will decode and validate a catalog file, json files are decoded as yaml
+func parseCatalog(file string, data []byte) (catalogFile, error) {
+	var catalog catalogFile
+	if err := yaml.UnmarshalStrict(data, &catalog); err != nil {
+		return catalog, errors.Errorf("invalid policy catalog file '%v', err: %v", file, err)
+	}
+	if len(catalog.Groups) == 0 && len(catalog.Faults) == 0 && len(catalog.Scoping) == 0 {
+		return catalog, errors.Errorf("invalid policy catalog file '%v': no groups, faults or scoping defined", file)
+	}
+	for _, group := range catalog.Groups {
+		if err := validateGroup(group); err != nil {
+			return catalog, errors.Errorf("invalid policy catalog file '%v', group '%v': %v", file, group.Name, err)
+		}
+	}
+	for _, fault := range catalog.Faults {
+		if err := validateGroup(fault); err != nil {
+			return catalog, errors.Errorf("invalid policy catalog file '%v', fault '%v': %v", file, fault.Name, err)
+		}
+	}
+	for i, scoping := range catalog.Scoping {
+		if err := validateScoping(scoping); err != nil {
+			return catalog, errors.Errorf("invalid policy catalog file '%v', scoping %v: %v", file, i+1, err)
+		}
+	}
+	return catalog, nil
+}
+
+// validateGroup will check the resource group or fault against the catalog schema
+func validateGroup(group catalogGroup) error {
+	if !groupNamePattern.MatchString(group.Name) {
+		return errors.Errorf("the name must consist of lower case alphanumeric characters or '-'")
+	}
+	if len(group.Statements) == 0 {
+		return errors.Errorf("no statements defined")
+	}
+	for i, stmt := range group.Statements {
+		if stmt.Effect != "Allow" && stmt.Effect != "Deny" {
+			return errors.Errorf("statement %v: the effect must be Allow or Deny, got '%v'", i+1, stmt.Effect)
+		}
+		if len(stmt.Actions) == 0 {
+			return errors.Errorf("statement %v: no actions defined", i+1)
+		}
+		for _, action := range stmt.Actions {
+			if !actionPattern.MatchString(action) {
+				return errors.Errorf("statement %v: invalid action '%v', expected <service>:<action>", i+1, action)
+			}
+		}
+		for _, resource := range stmt.Resources {
+			if resource != "*" && !strings.HasPrefix(resource, "arn:") {
+				return errors.Errorf("statement %v: invalid resource '%v', expected '*' or an ARN", i+1, resource)
+			}
+		}
+	}
+	return nil
+}
+
+// validateScoping will check the resource types and condition keys of the actions against the catalog schema
+func validateScoping(scoping catalogScoping) error {
+	if len(scoping.Actions) == 0 {
+		return errors.Errorf("no actions defined")
+	}
+	for _, action := range scoping.Actions {
+		if !actionPattern.MatchString(action) || strings.ContainsAny(action, "*?") {
+			return errors.Errorf("invalid action '%v', expected <service>:<action> without wildcards", action)
+		}
+	}
+	for _, resourceType := range scoping.ResourceTypes {
+		if !resourceTypePattern.MatchString(resourceType) {
+			return errors.Errorf("invalid resource type '%v', expected <service>:<resource-type>", resourceType)
+		}
+	}
+	for _, key := range scoping.ConditionKeys {
+		if !scopeConditionKeys[key] {
+			return errors.Errorf("unsupported condition key '%v', supported keys are %v", key, sortedKeys(scopeConditionKeys))
+		}
+	}
+	return nil
+}
+
+// add will register the resource groups and faults of the given source, they can only replace the built-in ones when allowed
+func (r *Registry) add(catalog catalogFile, source string, override bool) error {
+	if err := addGroups(r.groups, catalog.Groups, kindGroup, source, override); err != nil {
+		return err
+	}
+	if err := addGroups(r.faults, catalog.Faults, kindFault, source, override); err != nil {
+		return err
+	}
+	for _, scoping := range catalog.Scoping {
+		for _, action := range scoping.Actions {
+			if _, ok := r.scoping[action]; ok && !override {
+				return errors.Errorf("invalid policy catalog file '%v', the scoping of action '%v' is already defined", source, action)
+			}
+			r.scoping[action] = scoping
+		}
+	}
+	return nil
+}
+
+// addGroups will convert the catalog groups into policy groups and register them
+func addGroups(registered map[string]PolicyGroup, groups []catalogGroup, kind, source string, override bool) error {
+	for _, group := range groups {
+		if existing, ok := registered[group.Name]; ok {
+			if !override {
+				return errors.Errorf("invalid policy catalog file '%v', %v '%v': already defined in '%v'", source, kind, group.Name, existing.Source)
+			}
+			log.Infof("[Info]: The %v '%v' of the %v catalog is overridden by '%v'", kind, group.Name, existing.Source, source)
+		}
+		policyGroup := PolicyGroup{Name: group.Name, Description: group.Description, Source: source}
+		for _, stmt := range group.Statements {
+			resources := stmt.Resources
+			if len(resources) == 0 {
+				resources = []string{"*"}
+			}
+			policyGroup.Statements = append(policyGroup.Statements, Statement{
+				Effect:    stmt.Effect,
+				Action:    stmt.Actions,
+				Resource:  resources,
+				Condition: stmt.Conditions,
+			})
+		}
+		registered[group.Name] = policyGroup
+	}
+	return nil
+}
+
+// Group will return the resource group with the given name
+func (r *Registry) Group(name string) (PolicyGroup, bool) {
+	group, ok := r.groups[name]
+	return group, ok
+}
+
+// Groups will return all the resource groups of the catalog sorted by name
+func (r *Registry) Groups() []PolicyGroup {
+	return sortedGroups(r.groups)
+}
+
+// Faults will return all the faults of the catalog sorted by name
+func (r *Registry) Faults() []PolicyGroup {
+	return sortedGroups(r.faults)
+}
+
+// ResourceGroups will return a summary of all the resource groups of the catalog sorted by name
+func (r *Registry) ResourceGroups() []ResourceGroup {
+	return summarize(r.Groups())
+}
+
+// FaultGroups will return a summary of all the faults of the catalog sorted by name
+func (r *Registry) FaultGroups() []ResourceGroup {
+	return summarize(r.Faults())
+}
+
+// Explain will return each action of the policy for the given resource groups and faults along with
+// the resource groups and faults which contributed it, sorted by action
+func (r *Registry) Explain(resourceGroups, faults string) ([]ActionSource, error) {
+
+	groups, faultGroups, err := r.selection(resourceGroups, faults)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]*ActionSource{}
+	source := func(action string) *ActionSource {
+		if sources[action] == nil {
+			sources[action] = &ActionSource{Action: action}
+		}
+		return sources[action]
+	}
+	for _, group := range groups {
+		for _, action := range statementActions(group.Statements) {
+			source(action).ResourceGroups = append(source(action).ResourceGroups, group.Name)
+		}
+	}
+	for _, fault := range faultGroups {
+		for _, action := range statementActions(fault.Statements) {
+			source(action).Faults = append(source(action).Faults, fault.Name)
+		}
+	}
+
+	var result []ActionSource
+	for _, source := range sources {
+		result = append(result, *source)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Action < result[j].Action })
+	return result, nil
+}
+
+// selection will look up the comma separated resource groups and faults in the catalog, at least one is needed
+func (r *Registry) selection(resourceGroups, faults string) ([]PolicyGroup, []PolicyGroup, error) {
+	groups, err := r.parse(resourceGroups)
+	if err != nil {
+		return nil, nil, err
+	}
+	faultGroups, err := r.parseFaults(faults)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) == 0 && len(faultGroups) == 0 {
+		return nil, nil, errors.Errorf("no resources or faults provided, supported resource types are %v", sortedNames(r.groups))
+	}
+	return groups, faultGroups, nil
+}
+
+// parse will split the comma separated resource groups and look them up in the catalog
+func (r *Registry) parse(resourceGroups string) ([]PolicyGroup, error) {
+	var groups []PolicyGroup
+	seen := map[string]bool{}
+	for _, name := range splitNames(resourceGroups) {
+		group, ok := r.groups[name]
+		if !ok {
+			return nil, errors.Errorf("unknown resource type: %v, supported resource types are %v", name, sortedNames(r.groups))
+		}
+		if !seen[name] {
+			seen[name] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// parseFaults will split the comma separated faults and look them up in the catalog, the unknown faults are
+// reported together along with the closest supported faults
+func (r *Registry) parseFaults(faults string) ([]PolicyGroup, error) {
+	var groups []PolicyGroup
+	var unknown []string
+	seen := map[string]bool{}
+	for _, name := range splitNames(faults) {
+		fault, ok := r.faults[name]
+		if !ok {
+			if suggestions := suggest(name, sortedNames(r.faults)); len(suggestions) != 0 {
+				name += " (did you mean " + strings.Join(suggestions, " or ") + "?)"
+			}
+			unknown = append(unknown, name)
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			groups = append(groups, fault)
+		}
+	}
+	if len(unknown) != 0 {
+		return nil, errors.Errorf("unknown faults: %v, run 'policy list --faults' to see the supported faults", strings.Join(unknown, ", "))
+	}
+	return groups, nil
+}
+
+// splitNames will split the comma separated names, ignoring the empty ones
+func splitNames(names string) []string {
+	var result []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// suggest will return the candidates close to the given name, either by edit distance or by containing all its words
+func suggest(name string, candidates []string) []string {
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	var suggestions []string
+	for _, candidate := range candidates {
+		if levenshtein(name, candidate) <= maxDistance || containsWords(candidate, name) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	if len(suggestions) > 3 {
+		suggestions = suggestions[:3]
+	}
+	return suggestions
+}
+
+// containsWords will check if every '-' separated word of the name is a word of the candidate
+func containsWords(candidate, name string) bool {
+	words := map[string]bool{}
+	for _, word := range strings.Split(candidate, "-") {
+		words[word] = true
+	}
+	for _, word := range strings.Split(name, "-") {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// levenshtein will return the edit distance between the two strings
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+// sortedGroups will return the given groups sorted by name
+func sortedGroups(registered map[string]PolicyGroup) []PolicyGroup {
+	var groups []PolicyGroup
+	for _, name := range sortedNames(registered) {
+		groups = append(groups, registered[name])
+	}
+	return groups
+}
+
+// sortedNames will return the names of the given groups sorted by name
+func sortedNames(registered map[string]PolicyGroup) []string {
+	var names []string
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// summarize will return the number of actions of each of the given groups
+func summarize(groups []PolicyGroup) []ResourceGroup {
+	var summary []ResourceGroup
+	for _, group := range groups {
+		summary = append(summary, ResourceGroup{
+			Name:        group.Name,
+			Description: group.Description,
+			Source:      group.Source,
+			Actions:     len(statementActions(group.Statements)),
+		})
+	}
+	return summary
+}
+
+// statementActions will return the distinct actions of the given statements
+func statementActions(statements []Statement) []string {
+	var actions []string
+	seen := map[string]bool{}
+	for _, stmt := range statements {
+		for _, action := range stmt.Action {
+			if !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// statementKey will return the key of the statements whose actions can be merged, the ones with the same
+// effect, resources and conditions
+func statementKey(stmt Statement) string {
+	key, _ := json.Marshal(Statement{Effect: stmt.Effect, Resource: stmt.Resource, Condition: stmt.Condition})
+	return string(key)
+}
@@ -0,0 +1,301 @@
+package aws
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// namespaceTagKey is the tag holding the chaos infra namespace for which the aws resource is created
+const namespaceTagKey = "hce.harness.io/infra-namespace"
+
+// managedTags will return the tags which mark an aws resource as created by this cli
+func managedTags(namespace string) []*iam.Tag {
+	return []*iam.Tag{
+		{Key: aws.String(types.ManagedByKey), Value: aws.String(types.ManagedByValue)},
+		{Key: aws.String(namespaceTagKey), Value: aws.String(namespace)},
+	}
+}
+
+// isManaged will check if the given tags carry the managed-by marker of this cli
+func isManaged(tags []*iam.Tag) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == types.ManagedByKey && aws.StringValue(tag.Value) == types.ManagedByValue {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound will check if the given error is an aws NoSuchEntity error
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == iam.ErrCodeNoSuchEntityException
+	}
+	return false
+}
+
+// DeleteRoleAndPolicy will detach and delete the chaos policy and delete the chaos role, if they are created by this
+// cli. The managed policies attached by this cli are detached, from the role provided by the user as well.
+func DeleteRoleAndPolicy(params types.OnboardingParameters) error {
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+
+	if strings.TrimSpace(params.RoleName) != "" {
+		log.Warnf("[Warning]: Skipping the deletion of role '%v' as it was provided by the user", params.RoleName)
+		return DetachManagedPolicies(svc, params.RoleName, params.Infra.Namespace)
+	}
+
+	roleName, err := ChaosRoleName(params)
+	if err != nil {
+		return err
+	}
+	policyName, err := PolicyName(params, 0)
+	if err != nil {
+		return err
+	}
+
+	accountID, err := GetAccountID(params)
+	if err != nil {
+		return err
+	}
+
+	roleExists := true
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if !isNotFound(err) {
+			return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+		}
+		log.Infof("[Info]: The role '%v' is already deleted", roleName)
+		roleExists = false
+	}
+	if roleExists && !isManaged(role.Role.Tags) {
+		log.Warnf("[Warning]: Skipping the deletion of role '%v' as it was not created by this cli", roleName)
+		roleExists = false
+	}
+	// The role and policies of another cluster with the same names are left untouched
+	if err := CheckRoleCluster(params); err != nil {
+		return err
+	}
+
+	policyARNs, err := chaosPolicyARNs(svc, accountID, params.IAM.Path, roleName, policyName, roleExists)
+	if err != nil {
+		return err
+	}
+	for _, policyARN := range policyARNs {
+		if err := deletePolicy(svc, policyARN, roleName, params); err != nil {
+			return err
+		}
+	}
+
+	if !roleExists {
+		return nil
+	}
+	if err := DetachManagedPolicies(svc, roleName, params.Infra.Namespace); err != nil {
+		return err
+	}
+	if err := deleteInlinePolicies(svc, roleName, policyName); err != nil {
+		return err
+	}
+
+	// The role can only be deleted once nothing else is attached to it
+	attached, err := svc.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return errors.Errorf("failed to list the policies attached to role '%v', err: %v", roleName, err)
+	}
+	inline, err := svc.ListRolePolicies(&iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return errors.Errorf("failed to list the inline policies of role '%v', err: %v", roleName, err)
+	}
+	if len(attached.AttachedPolicies) != 0 || len(inline.PolicyNames) != 0 {
+		log.Warnf("[Warning]: Skipping the deletion of role '%v' as it has policies which are not created by this cli", roleName)
+		return nil
+	}
+
+	if _, err := svc.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(roleName)}); err != nil {
+		return errors.Errorf("failed to delete role '%v', err: %v", roleName, err)
+	}
+	log.Infof("[Info]: The role '%v' is deleted", roleName)
+	return nil
+}
+
+// chaosPolicyARNs will return the ARNs of the chaos policy documents of the infra namespace, the documents split
+// off the first one are looked up among the policies attached to the chaos role. The first document is expected
+// under the IAM path when it isn't attached.
+func chaosPolicyARNs(svc *iam.IAM, accountID, path, roleName, policyName string, roleExists bool) ([]string, error) {
+
+	firstARN := PolicyARN(accountID, path, policyName)
+	if !roleExists {
+		return []string{firstARN}, nil
+	}
+
+	attached, err := svc.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, errors.Errorf("failed to list the policies attached to role '%v', err: %v", roleName, err)
+	}
+	arns := map[string]string{}
+	for _, policy := range attached.AttachedPolicies {
+		arns[aws.StringValue(policy.PolicyName)] = aws.StringValue(policy.PolicyArn)
+	}
+	if arn, ok := arns[policyName]; ok {
+		firstARN = arn
+	}
+	policyARNs := []string{firstARN}
+	for i := 1; i < maxAttachedPolicies; i++ {
+		if arn, ok := arns[documentName(policyName, i)]; ok {
+			policyARNs = append(policyARNs, arn)
+		}
+	}
+	return policyARNs, nil
+}
+
+// deletePolicy will detach the policy from the chaos role and delete it along with all its versions
+func deletePolicy(svc *iam.IAM, policyARN, roleName string, params types.OnboardingParameters) error {
+
+	policy, err := svc.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		if isNotFound(err) {
+			log.Infof("[Info]: The policy '%v' is already deleted", policyARN)
+			return nil
+		}
+		return errors.Errorf("failed to get policy '%v', err: %v", policyARN, err)
+	}
+	if !isManaged(policy.Policy.Tags) {
+		log.Warnf("[Warning]: Skipping the deletion of policy '%v' as it was not created by this cli", policyARN)
+		return nil
+	}
+	if err := checkCluster("policy '"+policyARN+"'", policy.Policy.Tags, params); err != nil {
+		return err
+	}
+
+	entities, err := svc.ListEntitiesForPolicy(&iam.ListEntitiesForPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return errors.Errorf("failed to list the entities of policy '%v', err: %v", policyARN, err)
+	}
+	if len(entities.PolicyGroups) != 0 || len(entities.PolicyUsers) != 0 {
+		log.Warnf("[Warning]: Skipping the deletion of policy '%v' as it is attached to users or groups", policyARN)
+		return nil
+	}
+	for _, entity := range entities.PolicyRoles {
+		if aws.StringValue(entity.RoleName) != roleName {
+			log.Warnf("[Warning]: Skipping the deletion of policy '%v' as it is attached to role '%v'", policyARN, aws.StringValue(entity.RoleName))
+			return nil
+		}
+	}
+
+	if len(entities.PolicyRoles) != 0 {
+		if _, err := svc.DetachRolePolicy(&iam.DetachRolePolicyInput{
+			PolicyArn: aws.String(policyARN),
+			RoleName:  aws.String(roleName),
+		}); err != nil {
+			return errors.Errorf("failed to detach policy '%v' from role '%v', err: %v", policyARN, roleName, err)
+		}
+		log.Infof("[Info]: The policy '%v' is detached from role '%v'", policyARN, roleName)
+	}
+
+	// All the non-default versions must be deleted before the policy itself
+	versions, err := svc.ListPolicyVersions(&iam.ListPolicyVersionsInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return errors.Errorf("failed to list the versions of policy '%v', err: %v", policyARN, err)
+	}
+	for _, version := range versions.Versions {
+		if aws.BoolValue(version.IsDefaultVersion) {
+			continue
+		}
+		if _, err := svc.DeletePolicyVersion(&iam.DeletePolicyVersionInput{
+			PolicyArn: aws.String(policyARN),
+			VersionId: version.VersionId,
+		}); err != nil {
+			return errors.Errorf("failed to delete version '%v' of policy '%v', err: %v", aws.StringValue(version.VersionId), policyARN, err)
+		}
+	}
+
+	if _, err := svc.DeletePolicy(&iam.DeletePolicyInput{PolicyArn: aws.String(policyARN)}); err != nil {
+		return errors.Errorf("failed to delete policy '%v', err: %v", policyARN, err)
+	}
+	log.Infof("[Info]: The policy '%v' is deleted", policyARN)
+	return nil
+}
+
+// DeleteOIDCProvider will delete the OIDC provider if it was created by this cli and no role trusts it anymore
+func DeleteOIDCProvider(params types.OnboardingParameters) error {
+
+	providerARN, err := getProviderArn(params.ProviderUrl, params)
+	if err != nil {
+		log.Warnf("[Warning]: Skipping the deletion of OIDC provider, err: %v", err)
+		return nil
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+
+	tags, err := svc.ListOpenIDConnectProviderTags(&iam.ListOpenIDConnectProviderTagsInput{
+		OpenIDConnectProviderArn: aws.String(providerARN),
+	})
+	if err != nil {
+		return errors.Errorf("failed to list the tags of OIDC provider '%v', err: %v", providerARN, err)
+	}
+	if !isManaged(tags.Tags) {
+		log.Warnf("[Warning]: Skipping the deletion of OIDC provider '%v' as it was not created by this cli", providerARN)
+		return nil
+	}
+
+	// Look for any role which still trusts the provider
+	var trustingRole string
+	err = svc.ListRolesPages(&iam.ListRolesInput{}, func(page *iam.ListRolesOutput, lastPage bool) bool {
+		for _, role := range page.Roles {
+			document, err := url.QueryUnescape(aws.StringValue(role.AssumeRolePolicyDocument))
+			if err != nil {
+				continue
+			}
+			if strings.Contains(document, providerARN) {
+				trustingRole = aws.StringValue(role.RoleName)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return errors.Errorf("failed to list roles, err: %v", err)
+	}
+	if trustingRole != "" {
+		log.Warnf("[Warning]: Skipping the deletion of OIDC provider '%v' as it is trusted by role '%v'", providerARN, trustingRole)
+		return nil
+	}
+
+	if _, err := svc.DeleteOpenIDConnectProvider(&iam.DeleteOpenIDConnectProviderInput{
+		OpenIDConnectProviderArn: aws.String(providerARN),
+	}); err != nil {
+		return errors.Errorf("failed to delete OIDC provider '%v', err: %v", providerARN, err)
+	}
+	log.Infof("[Info]: The OIDC provider '%v' is deleted", providerARN)
+	return nil
+}
+
+// GetAccountID will return the aws account ID of the configured credentials
+func GetAccountID(params types.OnboardingParameters) (string, error) {
+
+	sess, err := Session(params)
+	if err != nil {
+		return "", err
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errors.Errorf("failed to get the aws account ID, err: %v", err)
+	}
+	return aws.StringValue(identity.Account), nil
+}
@@ -0,0 +1,317 @@
+package aws
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	instanceIDPattern   = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+	dbInstanceIDPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{0,62}$`)
+)
+
+// GuardrailResult is the Deny statements of a guardrail along with the reasons it doesn't deny all the chaos
+// actions it selects
+type GuardrailResult struct {
+	Name       string      `json:"name"`
+	Statements []Statement `json:"statements,omitempty"`
+	Issues     []string    `json:"issues,omitempty"`
+}
+
+// LoadGuardrails will read the guardrails of the yaml or json file
+func LoadGuardrails(file string) ([]types.Guardrail, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Errorf("failed to read guardrails file '%v', err: %v", file, err)
+	}
+	var guardrails []types.Guardrail
+	if err := yaml.UnmarshalStrict(data, &guardrails); err != nil {
+		return nil, errors.Errorf("invalid guardrails file '%v', err: %v", file, err)
+	}
+	return guardrails, nil
+}
+
+// Guardrails will build the Deny statements of each guardrail for the actions granted by the policy. An action is
+// only denied through the resource types and condition keys it supports, the ones which can't be denied are
+// reported as issues of the guardrail.
+func (r *Registry) Guardrails(policy Policy, guardrails []types.Guardrail) ([]GuardrailResult, error) {
+
+	granted := grantedMutatingActions(policy)
+
+	var results []GuardrailResult
+	names := map[string]bool{}
+	for i, guardrail := range guardrails {
+		guardrail.Name = guardrailName(guardrail, i)
+		if names[guardrail.Name] {
+			return nil, errors.Errorf("invalid guardrail '%v': defined twice", guardrail.Name)
+		}
+		names[guardrail.Name] = true
+		if err := validateGuardrail(guardrail); err != nil {
+			return nil, errors.Errorf("invalid guardrail '%v': %v", guardrail.Name, err)
+		}
+		results = append(results, r.guardrail(guardrail, granted))
+	}
+	return results, nil
+}
+
+// guardrail will build the Deny statements of the guardrail for the granted actions
+func (r *Registry) guardrail(guardrail types.Guardrail, granted []string) GuardrailResult {
+
+	result := GuardrailResult{Name: guardrail.Name}
+
+	actions := granted
+	if len(guardrail.Actions) != 0 {
+		actions = nil
+		for _, pattern := range guardrail.Actions {
+			var matched []string
+			for _, action := range granted {
+				if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(action)); ok {
+					matched = append(matched, action)
+				}
+			}
+			if len(matched) == 0 {
+				result.Issues = append(result.Issues, "the action "+pattern+" is not granted by the chaos policy")
+			}
+			actions = append(actions, matched...)
+		}
+		actions = subtract(actions, nil)
+	}
+	if len(actions) == 0 {
+		result.Issues = append(result.Issues, "the chaos policy grants none of its actions")
+		return result
+	}
+
+	// supporting will split the actions by whether they support the condition key or resource type
+	supporting := func(supports func(scoping catalogScoping) bool) ([]string, []string) {
+		var supported, unsupported []string
+		for _, action := range actions {
+			if supports(r.scoping[action]) {
+				supported = append(supported, action)
+			} else {
+				unsupported = append(unsupported, action)
+			}
+		}
+		return supported, unsupported
+	}
+	deny := func(actions, resources []string, condition map[string]map[string]interface{}) {
+		result.Statements = append(result.Statements, Statement{Effect: "Deny", Action: actions, Resource: resources, Condition: condition})
+	}
+	report := func(unsupported []string, selector string) {
+		if len(unsupported) != 0 {
+			result.Issues = append(result.Issues, "the actions "+strings.Join(unsupported, ", ")+" can't be denied by "+selector)
+		}
+	}
+
+	if len(guardrail.Tags) != 0 {
+		supported, unsupported := supporting(func(scoping catalogScoping) bool { return contains(scoping.ConditionKeys, conditionResourceTag) })
+		if len(supported) != 0 {
+			// A resource with any of the tags is protected
+			for _, key := range sortedKeys(guardrail.Tags) {
+				deny(supported, []string{"*"}, map[string]map[string]interface{}{
+					"StringEquals": {conditionResourceTag + "/" + key: guardrail.Tags[key]},
+				})
+			}
+		}
+		report(unsupported, "tag")
+	}
+	if len(guardrail.InstanceIDs) != 0 {
+		// Only the actions acting on the resource type can be denied by its identifiers
+		supported, _ := supporting(func(scoping catalogScoping) bool { return contains(scoping.ResourceTypes, "ec2:instance") })
+		if len(supported) != 0 {
+			var resources []string
+			for _, id := range guardrail.InstanceIDs {
+				resources = append(resources, "arn:*:ec2:*:*:instance/"+id)
+			}
+			deny(supported, resources, nil)
+		} else {
+			result.Issues = append(result.Issues, "no action of the chaos policy acts on EC2 instances")
+		}
+	}
+	if len(guardrail.DBInstanceIDs) != 0 {
+		supported, _ := supporting(func(scoping catalogScoping) bool { return contains(scoping.ResourceTypes, "rds:db") })
+		if len(supported) != 0 {
+			var resources []string
+			for _, id := range guardrail.DBInstanceIDs {
+				resources = append(resources, "arn:*:rds:*:*:db:"+id)
+			}
+			deny(supported, resources, nil)
+		} else {
+			result.Issues = append(result.Issues, "no action of the chaos policy acts on DB instances")
+		}
+	}
+	if len(guardrail.Regions) != 0 {
+		supported, unsupported := supporting(func(scoping catalogScoping) bool { return contains(scoping.ConditionKeys, conditionRequestedRegion) })
+		if len(supported) != 0 {
+			deny(supported, []string{"*"}, map[string]map[string]interface{}{
+				"StringEquals": {conditionRequestedRegion: guardrail.Regions},
+			})
+		}
+		report(unsupported, "region")
+	}
+	return result
+}
+
+// guardrailName will return the name of the guardrail, the unnamed ones are named after their position
+func guardrailName(guardrail types.Guardrail, index int) string {
+	if guardrail.Name != "" {
+		return guardrail.Name
+	}
+	return "guardrail-" + strconv.Itoa(index+1)
+}
+
+// validateGuardrail will check that the guardrail selects resources and that the selectors are well formed
+func validateGuardrail(guardrail types.Guardrail) error {
+	if len(guardrail.Tags) == 0 && len(guardrail.InstanceIDs) == 0 && len(guardrail.DBInstanceIDs) == 0 && len(guardrail.Regions) == 0 {
+		return errors.Errorf("no tags, instance IDs, DB instance IDs or regions selecting the protected resources")
+	}
+	for key := range guardrail.Tags {
+		if !tagKeyPattern.MatchString(key) {
+			return errors.Errorf("invalid tag key '%v'", key)
+		}
+	}
+	for _, id := range guardrail.InstanceIDs {
+		if !instanceIDPattern.MatchString(id) {
+			return errors.Errorf("invalid instance ID '%v'", id)
+		}
+	}
+	for _, id := range guardrail.DBInstanceIDs {
+		if !dbInstanceIDPattern.MatchString(id) {
+			return errors.Errorf("invalid DB instance identifier '%v'", id)
+		}
+	}
+	for _, region := range guardrail.Regions {
+		if !regionPattern.MatchString(region) {
+			return errors.Errorf("invalid region '%v'", region)
+		}
+	}
+	for _, action := range guardrail.Actions {
+		if !actionPattern.MatchString(action) {
+			return errors.Errorf("invalid action '%v', expected <service>:<action>", action)
+		}
+	}
+	return nil
+}
+
+// ApplyGuardrails will add the Deny statements of the guardrails to the policy, a guardrail which denies nothing
+// is an error
+func ApplyGuardrails(policy Policy, results []GuardrailResult) (Policy, error) {
+	for _, result := range results {
+		if len(result.Statements) == 0 {
+			return Policy{}, errors.Errorf("the guardrail '%v' denies nothing: %v", result.Name, strings.Join(result.Issues, "; "))
+		}
+		policy.Statement = append(policy.Statement, result.Statements...)
+	}
+	return policy, nil
+}
+
+// CheckGuardrails will build the guardrails of the params for the chaos policy and look up their protected
+// resources in the region. The selectors which match no resource are added to the issues of the guardrail, as it
+// doesn't protect anything through them.
+func CheckGuardrails(params types.OnboardingParameters) ([]GuardrailResult, error) {
+
+	if len(params.Guardrails) == 0 {
+		return nil, nil
+	}
+	registry, err := NewRegistry(params.PolicyCatalog)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := registry.Build(params.Resources, params.Faults)
+	if err != nil {
+		return nil, err
+	}
+	if policy, err = registry.ScopePolicy(policy, params.Scope); err != nil {
+		return nil, err
+	}
+	results, err := registry.Guardrails(policy, params.Guardrails)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	tagging := resourcegroupstaggingapi.New(sess)
+	ec2Svc := ec2.New(sess)
+	rdsSvc := rds.New(sess)
+
+	for i, guardrail := range params.Guardrails {
+		issue := func(issue string) {
+			results[i].Issues = append(results[i].Issues, issue)
+		}
+		for _, key := range sortedKeys(guardrail.Tags) {
+			tag := key + "=" + guardrail.Tags[key]
+			resources, err := tagging.GetResources(&resourcegroupstaggingapi.GetResourcesInput{
+				TagFilters:       []*resourcegroupstaggingapi.TagFilter{{Key: aws.String(key), Values: aws.StringSlice([]string{guardrail.Tags[key]})}},
+				ResourcesPerPage: aws.Int64(1),
+			})
+			switch {
+			case err != nil:
+				issue("failed to look up the resources tagged " + tag + ", err: " + err.Error())
+			case len(resources.ResourceTagMappingList) == 0:
+				issue("no resource in " + params.Region + " is tagged " + tag)
+			}
+		}
+		for _, id := range guardrail.InstanceIDs {
+			instances, err := ec2Svc.DescribeInstances(&ec2.DescribeInstancesInput{
+				Filters: []*ec2.Filter{{Name: aws.String("instance-id"), Values: aws.StringSlice([]string{id})}},
+			})
+			switch {
+			case err != nil:
+				issue("failed to look up the instance " + id + ", err: " + err.Error())
+			case len(instances.Reservations) == 0:
+				issue("the instance " + id + " doesn't exist in " + params.Region)
+			}
+		}
+		for _, id := range guardrail.DBInstanceIDs {
+			_, err := rdsSvc.DescribeDBInstances(&rds.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String(id)})
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == rds.ErrCodeDBInstanceNotFoundFault {
+				issue("the DB instance " + id + " doesn't exist in " + params.Region)
+			} else if err != nil {
+				issue("failed to look up the DB instance " + id + ", err: " + err.Error())
+			}
+		}
+	}
+	return results, nil
+}
+
+// grantedMutatingActions will return the actions allowed by the policy which are not read only, sorted
+func grantedMutatingActions(policy Policy) []string {
+	var actions []string
+	for _, stmt := range policy.Statement {
+		if stmt.Effect != "Allow" {
+			continue
+		}
+		for _, action := range stmt.Action {
+			if !isReadOnly(action) && !strings.ContainsAny(action, "*?") {
+				actions = append(actions, action)
+			}
+		}
+	}
+	sort.Strings(actions)
+	return subtract(actions, nil)
+}
+
+// contains will check if the list has the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
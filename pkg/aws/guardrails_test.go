@@ -0,0 +1,147 @@
+package aws
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+func TestGuardrails(t *testing.T) {
+
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected err: %v", err)
+	}
+	policy := testPolicy(testAllow("ec2:DescribeInstances", "ec2:StartInstances", "ec2:StopInstances", "ec2:CreateNetworkAcl"))
+
+	tests := []struct {
+		name       string
+		guardrails []types.Guardrail
+		want       []GuardrailResult
+		wantErr    string
+	}{
+		{
+			name:       "tags deny the actions supporting the tag condition",
+			guardrails: []types.Guardrail{{Name: "prod", Tags: map[string]string{"env": "prod"}}},
+			want: []GuardrailResult{{
+				Name: "prod",
+				Statements: []Statement{{
+					Effect:    "Deny",
+					Action:    []string{"ec2:StartInstances", "ec2:StopInstances"},
+					Resource:  []string{"*"},
+					Condition: testCondition("StringEquals", "aws:ResourceTag/env", "prod"),
+				}},
+				Issues: []string{"the actions ec2:CreateNetworkAcl can't be denied by tag"},
+			}},
+		},
+		{
+			name:       "instance IDs deny the actions on instances",
+			guardrails: []types.Guardrail{{InstanceIDs: []string{"i-0123456789abcdef0"}, Actions: []string{"ec2:Stop*"}}},
+			want: []GuardrailResult{{
+				Name: "guardrail-1",
+				Statements: []Statement{{
+					Effect:   "Deny",
+					Action:   []string{"ec2:StopInstances"},
+					Resource: []string{"arn:*:ec2:*:*:instance/i-0123456789abcdef0"},
+				}},
+			}},
+		},
+		{
+			name:       "actions which are not granted",
+			guardrails: []types.Guardrail{{Name: "none", Regions: []string{"us-east-1"}, Actions: []string{"rds:RebootDBInstance"}}},
+			want: []GuardrailResult{{
+				Name:   "none",
+				Issues: []string{"the action rds:RebootDBInstance is not granted by the chaos policy", "the chaos policy grants none of its actions"},
+			}},
+		},
+		{
+			name:       "DB instance IDs without any action on DB instances",
+			guardrails: []types.Guardrail{{Name: "db", DBInstanceIDs: []string{"orders"}}},
+			want: []GuardrailResult{{
+				Name:   "db",
+				Issues: []string{"no action of the chaos policy acts on DB instances"},
+			}},
+		},
+		{
+			name:       "guardrail without selectors",
+			guardrails: []types.Guardrail{{Name: "empty"}},
+			wantErr:    "invalid guardrail 'empty': no tags, instance IDs, DB instance IDs or regions",
+		},
+		{
+			name:       "invalid instance ID",
+			guardrails: []types.Guardrail{{InstanceIDs: []string{"web-1"}}},
+			wantErr:    "invalid guardrail 'guardrail-1': invalid instance ID 'web-1'",
+		},
+		{
+			name:       "guardrail defined twice",
+			guardrails: []types.Guardrail{{Name: "prod", Regions: []string{"us-east-1"}}, {Name: "prod", Regions: []string{"us-west-2"}}},
+			wantErr:    "invalid guardrail 'prod': defined twice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := registry.Guardrails(policy, tt.guardrails)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Guardrails() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Guardrails() unexpected err: %v", err)
+			}
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Errorf("Guardrails() = %+v, want %+v", results, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyGuardrails(t *testing.T) {
+
+	deny := Statement{Effect: "Deny", Action: []string{"ec2:StopInstances"}, Resource: []string{testInstanceARN}}
+	policy := testPolicy(testAllow("ec2:StopInstances"))
+
+	tests := []struct {
+		name    string
+		results []GuardrailResult
+		want    []Statement
+		wantErr string
+	}{
+		{
+			name: "no guardrails",
+			want: []Statement{testAllow("ec2:StopInstances")},
+		},
+		{
+			name:    "deny statements are appended",
+			results: []GuardrailResult{{Name: "prod", Statements: []Statement{deny}, Issues: []string{"partial"}}},
+			want:    []Statement{testAllow("ec2:StopInstances"), deny},
+		},
+		{
+			name:    "guardrail which denies nothing",
+			results: []GuardrailResult{{Name: "prod", Statements: []Statement{deny}}, {Name: "db", Issues: []string{"no action of the chaos policy acts on DB instances"}}},
+			wantErr: "the guardrail 'db' denies nothing: no action of the chaos policy acts on DB instances",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, err := ApplyGuardrails(policy, tt.results)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ApplyGuardrails() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyGuardrails() unexpected err: %v", err)
+			}
+			if !reflect.DeepEqual(applied.Statement, tt.want) {
+				t.Errorf("ApplyGuardrails() = %+v, want %+v", applied.Statement, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+const (
+	// minSessionDuration and maxSessionDuration are the bounds in seconds of the maximum session duration of a role
+	minSessionDuration = 3600
+	maxSessionDuration = 43200
+	// maxDescriptionLength is the maximum number of characters of the description of a role or policy
+	maxDescriptionLength = 1000
+	// maxTags is the maximum number of tags of an IAM resource
+	maxTags = 50
+	// maxTagValueLength is the maximum number of characters of the value of an IAM tag
+	maxTagValueLength = 256
+)
+
+var (
+	policyARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::([0-9]{12}|aws):policy/[\w+=,.@/-]+$`)
+	pathPattern      = regexp.MustCompile(`^/([\x21-\x7e]{1,510}/)?$`)
+	tagValuePattern  = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{0,256}$`)
+)
+
+// ValidateIAMOptions will check the IAM options before anything is created, so a malformed boundary, tag or path
+// doesn't fail the onboarding halfway
+func ValidateIAMOptions(options types.IAMOptions) error {
+
+	if options.PermissionsBoundary != "" && !policyARNPattern.MatchString(options.PermissionsBoundary) {
+		return errors.Errorf("invalid permissions boundary '%v', expected the ARN of a managed policy like arn:aws:iam::<account>:policy/<name>", options.PermissionsBoundary)
+	}
+	tags, err := parseTags(options.Tags)
+	if err != nil {
+		return errors.Errorf("invalid IAM tags, %v", err)
+	}
+	for key, value := range tags {
+		if key == types.ManagedByKey || key == namespaceTagKey || key == clusterTagKey || strings.HasPrefix(key, attachmentTagPrefix) {
+			return errors.Errorf("invalid IAM tag '%v', the tag is set by the cli", key)
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return errors.Errorf("invalid IAM tag '%v', the aws: prefix is reserved", key)
+		}
+		if !tagValuePattern.MatchString(value) {
+			return errors.Errorf("invalid value '%v' of IAM tag '%v'", value, key)
+		}
+	}
+	// The managed tags and the cluster tag are added by the cli, along with a tag of the role per attached policy
+	attached := splitNames(options.ManagedPolicyARNs)
+	if reserved := len(managedTags("")) + 1 + len(attached); len(tags)+reserved > maxTags {
+		return errors.Errorf("too many IAM tags, at most %v can be added along with the %v managed policies attached to the role", maxTags-reserved, len(attached))
+	}
+	if options.Path != "" && !pathPattern.MatchString(options.Path) {
+		return errors.Errorf("invalid IAM path '%v', expected a path starting and ending with '/' like /chaos/", options.Path)
+	}
+	if len(options.Description) > maxDescriptionLength {
+		return errors.Errorf("invalid description, it has %v characters which exceeds the limit of %v", len(options.Description), maxDescriptionLength)
+	}
+	if options.MaxSessionDuration != 0 && (options.MaxSessionDuration < minSessionDuration || options.MaxSessionDuration > maxSessionDuration) {
+		return errors.Errorf("invalid max session duration %v, expected between %v and %v seconds", options.MaxSessionDuration, minSessionDuration, maxSessionDuration)
+	}
+	for _, policyARN := range attached {
+		if !policyARNPattern.MatchString(policyARN) {
+			return errors.Errorf("invalid managed policy ARN '%v', expected arn:aws:iam::<account>:policy/<name> or arn:aws:iam::aws:policy/<name>", policyARN)
+		}
+		// The attachment is recorded in a tag of the role holding the policy ARN
+		if len(policyARN) > maxTagValueLength {
+			return errors.Errorf("invalid managed policy ARN '%v', it has %v characters which exceeds the limit of %v characters of the role tag recording the attachment", policyARN, len(policyARN), maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// parseTags will split the comma separated key=value tags
+func parseTags(list string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range splitNames(list) {
+		parts := strings.SplitN(tag, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !tagKeyPattern.MatchString(key) {
+			return nil, errors.Errorf("invalid tag '%v', expected key=value", tag)
+		}
+		tags[key] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
+// resourceTags will return the tags of an IAM resource created for the infra namespace, the managed tags of the cli
+// and the OIDC issuer of the cluster followed by the IAM tags of the params
+func resourceTags(params types.OnboardingParameters) []*iam.Tag {
+	tags := managedTags(params.Infra.Namespace)
+	if identity := clusterIdentity(params); identity != "" {
+		tags = append(tags, &iam.Tag{Key: aws.String(clusterTagKey), Value: aws.String(identity)})
+	}
+	// The tags are validated before anything is created
+	extra, _ := parseTags(params.IAM.Tags)
+	for _, key := range sortedKeys(extra) {
+		tags = append(tags, &iam.Tag{Key: aws.String(key), Value: aws.String(extra[key])})
+	}
+	return tags
+}
+
+// RoleSettings are the settings of the chaos role created by the cli
+type RoleSettings struct {
+	Path                string            `json:"path"`
+	Description         string            `json:"description,omitempty"`
+	PermissionsBoundary string            `json:"permissionsBoundary,omitempty"`
+	MaxSessionDuration  int               `json:"maxSessionDuration,omitempty"`
+	Tags                map[string]string `json:"tags"`
+}
+
+// PlanRoleSettings will return the settings the chaos role is created with
+func PlanRoleSettings(params types.OnboardingParameters) RoleSettings {
+	settings := RoleSettings{
+		Path:                iamPathPrefix(params.IAM.Path),
+		Description:         params.IAM.Description,
+		PermissionsBoundary: params.IAM.PermissionsBoundary,
+		MaxSessionDuration:  params.IAM.MaxSessionDuration,
+		Tags:                map[string]string{},
+	}
+	for _, tag := range resourceTags(params) {
+		settings.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return settings
+}
+
+// optionalString will return nil for an empty value, so the default of aws is kept
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// iamError will wrap the error of an IAM request, an explicit deny usually comes from a service control policy or
+// a permissions policy of the organisation requiring a boundary, tags or a path on the created resources
+func iamError(operation string, err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "AccessDenied" {
+		message := strings.ToLower(aerr.Message())
+		if strings.Contains(message, "explicit deny") || strings.Contains(message, "service control policy") || strings.Contains(message, "permissions boundary") {
+			return errors.Errorf("failed to %v, the request is denied by a policy of the organisation which may require a permissions boundary (--permissions-boundary), tags (--iam-tags) or a path (--iam-path) on the IAM resources, err: %v", operation, err)
+		}
+	}
+	return errors.Errorf("failed to %v, err: %v", operation, err)
+}
@@ -0,0 +1,72 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+func TestValidateIAMOptions(t *testing.T) {
+
+	tags := func(count int) string {
+		var result []string
+		for i := 0; i < count; i++ {
+			result = append(result, fmt.Sprintf("key-%v=value", i))
+		}
+		return strings.Join(result, ",")
+	}
+	longARN := "arn:aws:iam::123456789012:policy/" + strings.Repeat("p/", 120) + "chaos"
+
+	tests := []struct {
+		name    string
+		options types.IAMOptions
+		wantErr string
+	}{
+		{
+			name:    "tags within the limit",
+			options: types.IAMOptions{Tags: tags(maxTags - 3)},
+		},
+		{
+			name:    "tags over the limit",
+			options: types.IAMOptions{Tags: tags(maxTags - 2)},
+			wantErr: "too many IAM tags, at most 47 can be added",
+		},
+		{
+			name:    "attached policies count against the tag limit",
+			options: types.IAMOptions{Tags: tags(maxTags - 4), ManagedPolicyARNs: "arn:aws:iam::aws:policy/ReadOnlyAccess,arn:aws:iam::aws:policy/AmazonSSMReadOnlyAccess"},
+			wantErr: "at most 45 can be added along with the 2 managed policies attached to the role",
+		},
+		{
+			name:    "tag set by the cli",
+			options: types.IAMOptions{Tags: types.ManagedByKey + "=someone"},
+			wantErr: "the tag is set by the cli",
+		},
+		{
+			name:    "policy ARN longer than a tag value",
+			options: types.IAMOptions{ManagedPolicyARNs: longARN},
+			wantErr: "exceeds the limit of 256 characters of the role tag recording the attachment",
+		},
+		{
+			name:    "invalid policy ARN",
+			options: types.IAMOptions{ManagedPolicyARNs: "ReadOnlyAccess"},
+			wantErr: "invalid managed policy ARN 'ReadOnlyAccess'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIAMOptions(tt.options)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateIAMOptions() unexpected err: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateIAMOptions() err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// EKSIssuer will return the OIDC issuer of the EKS cluster
+func EKSIssuer(params types.OnboardingParameters) (string, error) {
+
+	clusterName := params.EKSClusterName
+	sess, err := Session(params)
+	if err != nil {
+		return "", err
+	}
+	svc := eks.New(sess)
+	cluster, err := svc.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return "", errors.Errorf("failed to describe EKS cluster '%v' in region '%v', err: %v", clusterName, params.Region, err)
+	}
+	if cluster.Cluster.Identity == nil || cluster.Cluster.Identity.Oidc == nil || aws.StringValue(cluster.Cluster.Identity.Oidc.Issuer) == "" {
+		return "", errors.Errorf("the EKS cluster '%v' has no OIDC issuer", clusterName)
+	}
+	return aws.StringValue(cluster.Cluster.Identity.Oidc.Issuer), nil
+}
+
+// SameIssuer will check if the provider URLs are the same OIDC issuer, ignoring the scheme and a trailing slash
+func SameIssuer(providerURL, issuer string) bool {
+	return normalizeIssuer(providerURL) == normalizeIssuer(issuer)
+}
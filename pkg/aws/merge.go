@@ -0,0 +1,464 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// TrustUpdate is the change to the trust policy of an existing role needed to trust the service accounts
+type TrustUpdate struct {
+	RoleName string `json:"roleName"`
+	Current  string `json:"current"`
+	Merged   string `json:"merged"`
+	Changed  bool   `json:"changed"`
+	Diff     string `json:"diff,omitempty"`
+}
+
+// trustEdit is an edit of the subjects trusted by a trust policy document
+type trustEdit func(document string, subjects []resolvedSubject) (string, bool, error)
+
+// PlanTrustUpdate will fetch the trust policy of the existing role and merge the statements for the experiment
+// service account and the extra trust subjects into it, without updating the role
+func PlanTrustUpdate(roleName string, params types.OnboardingParameters) (TrustUpdate, error) {
+	subjects, err := trustSubjects(params)
+	if err != nil {
+		return TrustUpdate{}, err
+	}
+	return planTrustEdit(roleName, subjects, AddTrustSubjects, params)
+}
+
+// PlanTrustSubjects will fetch the trust policy of the existing role and add or remove the given subjects,
+// without updating the role
+func PlanTrustSubjects(roleName string, subjects []types.TrustSubject, remove bool, params types.OnboardingParameters) (TrustUpdate, error) {
+	resolved, err := resolveSubjects(subjects, params)
+	if err != nil {
+		return TrustUpdate{}, err
+	}
+	edit := AddTrustSubjects
+	if remove {
+		edit = RemoveTrustSubjects
+	}
+	return planTrustEdit(roleName, resolved, edit, params)
+}
+
+// planTrustEdit will apply the edit of the subjects to the trust policy of the role
+func planTrustEdit(roleName string, subjects []resolvedSubject, edit trustEdit, params types.OnboardingParameters) (TrustUpdate, error) {
+	current, err := GetTrustPolicy(roleName, params)
+	if err != nil {
+		return TrustUpdate{}, err
+	}
+	return editTrustUpdate(roleName, current, subjects, edit)
+}
+
+// editTrustUpdate will apply the edit of the subjects to the given trust policy
+func editTrustUpdate(roleName, current string, subjects []resolvedSubject, edit trustEdit) (TrustUpdate, error) {
+	merged, changed, err := edit(current, subjects)
+	if err != nil {
+		return TrustUpdate{}, errors.Errorf("failed to merge the trust policy of role '%v', err: %v", roleName, err)
+	}
+	update := TrustUpdate{RoleName: roleName, Current: current, Merged: merged, Changed: changed}
+	if changed {
+		update.Diff = LineDiff(indentJSON(normalizeDocument(current)), indentJSON(normalizeDocument(merged)))
+	}
+	return update, nil
+}
+
+// ApplyTrustUpdate will write the merged trust policy to the role, nothing is done when it is unchanged
+func ApplyTrustUpdate(update TrustUpdate, params types.OnboardingParameters) error {
+	if !update.Changed {
+		return nil
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+
+	if _, err := svc.UpdateAssumeRolePolicy(&iam.UpdateAssumeRolePolicyInput{
+		RoleName:       aws.String(update.RoleName),
+		PolicyDocument: aws.String(update.Merged),
+	}); err != nil {
+		return errors.Errorf("failed to update the trust policy of role '%v', err: %v", update.RoleName, err)
+	}
+	return nil
+}
+
+// GetTrustPolicy will return the decoded trust policy document of the role
+func GetTrustPolicy(roleName string, params types.OnboardingParameters) (string, error) {
+
+	sess, err := Session(params)
+	if err != nil {
+		return "", err
+	}
+	svc := iam.New(sess)
+
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return "", errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	document, err := url.QueryUnescape(aws.StringValue(role.Role.AssumeRolePolicyDocument))
+	if err != nil {
+		return "", errors.Errorf("failed to decode the trust policy of role '%v', err: %v", roleName, err)
+	}
+	return document, nil
+}
+
+// AddTrustSubjects will add the subjects to the trust policy document. A subject is appended to the statement
+// trusting the same OIDC provider with the same condition operator, or gets a new statement when there is none.
+// The statements written by earlier versions for a subject without checking the sub claim are replaced, every
+// other statement and element of the document is kept as is. The document is unchanged when all the subjects
+// are already trusted.
+func AddTrustSubjects(document string, subjects []resolvedSubject) (string, bool, error) {
+
+	policy, statements, err := parseTrustPolicy(document)
+	if err != nil {
+		return "", false, err
+	}
+
+	changed := false
+	for _, subject := range subjects {
+		if findSubjects(statements, subject, subject.Subject) != -1 {
+			continue
+		}
+		changed = true
+
+		// Drop the statements for the subject which don't check the sub claim of the token
+		var kept []json.RawMessage
+		for _, raw := range statements {
+			var statement trustStatement
+			if err := json.Unmarshal(raw, &statement); err == nil && statement.hasFederatedPrincipal(subject.ProviderARN) &&
+				statement.trustsSubject(subject.Subject) && !statement.checksSubject(subject.IssuerHost) {
+				continue
+			}
+			kept = append(kept, raw)
+		}
+		statements = kept
+
+		index := findSubjects(statements, subject, "")
+		if index == -1 {
+			raw, err := json.Marshal(NewIRSAStatement(subject.ProviderARN, subject.IssuerHost, subject.operator(), []string{subject.Subject}))
+			if err != nil {
+				return "", false, errors.Errorf("failed to prepare the trust policy statement, err: %v", err)
+			}
+			statements = append(statements, raw)
+			continue
+		}
+		values, _ := statementSubjects(statements[index], subject)
+		if statements[index], err = setSubjects(statements[index], subject, append(values, subject.Subject)); err != nil {
+			return "", false, err
+		}
+	}
+
+	if !changed {
+		return document, false, nil
+	}
+	merged, err := writeTrustPolicy(policy, statements)
+	return merged, true, err
+}
+
+// RemoveTrustSubjects will remove the subjects from the statements trusting them, the statements left without
+// any subject are dropped. The document is unchanged when none of the subjects is trusted. IAM rejects a trust
+// policy without any statement, so the last subject trusted by the role can't be removed.
+func RemoveTrustSubjects(document string, subjects []resolvedSubject) (string, bool, error) {
+
+	policy, statements, err := parseTrustPolicy(document)
+	if err != nil {
+		return "", false, err
+	}
+
+	changed := false
+	for _, subject := range subjects {
+		for {
+			index := findSubjects(statements, subject, subject.Subject)
+			if index == -1 {
+				break
+			}
+			changed = true
+			values, _ := statementSubjects(statements[index], subject)
+			var remaining []string
+			for _, value := range values {
+				if value != subject.Subject {
+					remaining = append(remaining, value)
+				}
+			}
+			if len(remaining) == 0 {
+				statements = append(statements[:index], statements[index+1:]...)
+				continue
+			}
+			if statements[index], err = setSubjects(statements[index], subject, remaining); err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	if !changed {
+		return document, false, nil
+	}
+	if len(statements) == 0 {
+		return "", false, errors.New("refusing to remove the last subject trusted by the role, a trust policy needs at least one statement. Deregister the infra to delete the role instead")
+	}
+	merged, err := writeTrustPolicy(policy, statements)
+	return merged, true, err
+}
+
+// TrustedSubject is a service account trusted by a statement of a trust policy
+type TrustedSubject struct {
+	ProviderARN string `json:"providerARN"`
+	Operator    string `json:"operator"`
+	Subject     string `json:"subject"`
+}
+
+// ListTrustSubjects will return the service accounts trusted through an OIDC provider by the trust policy document
+func ListTrustSubjects(document string) ([]TrustedSubject, error) {
+
+	statements, err := trustStatements(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []TrustedSubject
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || !statement.allowsAction(webIdentityAction) {
+			continue
+		}
+		var principal struct {
+			Federated json.RawMessage
+		}
+		if err := json.Unmarshal(statement.Principal, &principal); err != nil || len(principal.Federated) == 0 {
+			continue
+		}
+		providers, err := stringOrSlice(principal.Federated)
+		if err != nil {
+			continue
+		}
+		for _, operator := range sortedKeys(statement.Condition) {
+			for _, key := range sortedKeys(statement.Condition[operator]) {
+				if !strings.HasSuffix(key, ":sub") {
+					continue
+				}
+				values, err := stringOrSlice(statement.Condition[operator][key])
+				if err != nil {
+					continue
+				}
+				for _, provider := range providers {
+					for _, value := range values {
+						subjects = append(subjects, TrustedSubject{ProviderARN: provider, Operator: operator, Subject: value})
+					}
+				}
+			}
+		}
+	}
+	return subjects, nil
+}
+
+// findSubjects will return the index of the statement trusting the subjects through the OIDC provider of the
+// subject with its condition operator and the sts audience, which also trusts the given value when not empty
+func findSubjects(statements []json.RawMessage, subject resolvedSubject, value string) int {
+	for i, raw := range statements {
+		values, ok := statementSubjects(raw, subject)
+		if !ok {
+			continue
+		}
+		if value == "" {
+			return i
+		}
+		for _, v := range values {
+			if v == value {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// statementSubjects will return the sub claims allowed by the statement when it trusts the OIDC provider of the
+// subject with the same condition operator and the sts audience
+func statementSubjects(raw json.RawMessage, subject resolvedSubject) ([]string, bool) {
+	var statement trustStatement
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return nil, false
+	}
+	if statement.Effect != "Allow" || !statement.allowsAction(webIdentityAction) || !statement.hasFederatedPrincipal(subject.ProviderARN) {
+		return nil, false
+	}
+	audiences, err := stringOrSlice(statement.Condition[operatorEquals][subject.IssuerHost+":aud"])
+	if err != nil || len(audiences) != 1 || audiences[0] != stsAudience {
+		return nil, false
+	}
+	raw, ok := statement.Condition[subject.operator()][subject.IssuerHost+":sub"]
+	if !ok {
+		return nil, false
+	}
+	values, err := stringOrSlice(raw)
+	if err != nil {
+		return nil, false
+	}
+	return values, true
+}
+
+// setSubjects will replace the sub claims allowed by the statement, a single subject is written as a string
+func setSubjects(raw json.RawMessage, subject resolvedSubject, values []string) (json.RawMessage, error) {
+	var statement map[string]interface{}
+	if err := json.Unmarshal(raw, &statement); err != nil {
+		return nil, errors.Errorf("failed to parse trust policy statement, err: %v", err)
+	}
+	condition, _ := statement["Condition"].(map[string]interface{})
+	conditions, _ := condition[subject.operator()].(map[string]interface{})
+	if conditions == nil {
+		return nil, errors.Errorf("the trust policy statement has no %v condition", subject.operator())
+	}
+	if len(values) == 1 {
+		conditions[subject.IssuerHost+":sub"] = values[0]
+	} else {
+		conditions[subject.IssuerHost+":sub"] = values
+	}
+	updated, err := json.Marshal(statement)
+	if err != nil {
+		return nil, errors.Errorf("failed to prepare the trust policy statement, err: %v", err)
+	}
+	return updated, nil
+}
+
+// parseTrustPolicy will decode the trust policy document, keeping its other elements as is
+func parseTrustPolicy(document string) (map[string]json.RawMessage, []json.RawMessage, error) {
+	var policy map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, nil, errors.Errorf("failed to parse trust policy, err: %v", err)
+	}
+	if policy == nil {
+		policy = map[string]json.RawMessage{}
+	}
+
+	// The Statement can either be a single statement or a list of statements
+	var statements []json.RawMessage
+	if raw, ok := policy["Statement"]; ok {
+		if err := json.Unmarshal(raw, &statements); err != nil {
+			statements = []json.RawMessage{raw}
+		}
+	}
+	return policy, statements, nil
+}
+
+// writeTrustPolicy will encode the trust policy document with the given statements
+func writeTrustPolicy(policy map[string]json.RawMessage, statements []json.RawMessage) (string, error) {
+	if statements == nil {
+		statements = []json.RawMessage{}
+	}
+	rawStatements, err := json.Marshal(statements)
+	if err != nil {
+		return "", errors.Errorf("failed to prepare the trust policy statements, err: %v", err)
+	}
+	policy["Statement"] = rawStatements
+	if _, ok := policy["Version"]; !ok {
+		policy["Version"] = json.RawMessage(`"2012-10-17"`)
+	}
+	merged, err := json.Marshal(policy)
+	if err != nil {
+		return "", errors.Errorf("failed to prepare the trust policy JSON, err: %v", err)
+	}
+	return string(merged), nil
+}
+
+// checksSubject will check if any condition of the statement is on the sub claim of the OIDC provider
+func (s trustStatement) checksSubject(issuerHost string) bool {
+	for _, conditions := range s.Condition {
+		if _, ok := conditions[issuerHost+":sub"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsSubject will check if any condition of the statement names the given subject
+func (s trustStatement) trustsSubject(subject string) bool {
+	for _, conditions := range s.Condition {
+		for _, raw := range conditions {
+			values, err := stringOrSlice(raw)
+			if err != nil {
+				continue
+			}
+			for _, value := range values {
+				if value == subject {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// normalizeDocument will format the IAM policy document with the keys sorted and the statements as a list, so the diff
+// only shows the actual changes
+func normalizeDocument(document string) string {
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return document
+	}
+	if statement, ok := policy["Statement"].(map[string]interface{}); ok {
+		policy["Statement"] = []interface{}{statement}
+	}
+	normalized, err := json.Marshal(policy)
+	if err != nil {
+		return document
+	}
+	return string(normalized)
+}
+
+// indentJSON will format the JSON document for display, it is returned as is when it is not valid JSON
+func indentJSON(document string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(document), "", "  "); err != nil {
+		return document
+	}
+	return out.String()
+}
+
+// LineDiff will return the line by line difference between the two texts, the removed lines are prefixed
+// with '-', the added ones with '+' and the common ones with a space
+func LineDiff(before, after string) string {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// Longest common subsequence of the lines
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return diff.String()
+}
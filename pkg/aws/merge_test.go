@@ -0,0 +1,231 @@
+package aws
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testProviderARN = "arn:aws:iam::123456789012:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/EXAMPLE"
+	testIssuerHost  = "oidc.eks.us-east-1.amazonaws.com/id/EXAMPLE"
+)
+
+// testSubject will return the subject trusted through the test OIDC provider
+func testSubject(namespace, serviceAccount string) resolvedSubject {
+	return resolvedSubject{ProviderARN: testProviderARN, IssuerHost: testIssuerHost, Subject: ServiceAccountSubject(namespace, serviceAccount)}
+}
+
+// testTrustDocument will return the trust policy document of the given statements
+func testTrustDocument(t *testing.T, statements ...TrustStatement) string {
+	document, err := json.Marshal(TrustPolicy{Version: "2012-10-17", Statement: statements})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(document)
+}
+
+// trustedSubjects will list the subjects of the document as operator and subject pairs
+func trustedSubjects(t *testing.T, document string) []string {
+	subjects, err := ListTrustSubjects(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, subject := range subjects {
+		result = append(result, subject.Operator+" "+subject.Subject)
+	}
+	return result
+}
+
+func TestAddTrustSubjects(t *testing.T) {
+
+	chaos := testSubject("hce", "litmus-admin")
+	other := testSubject("apps", "runner")
+	wildcard := testSubject("team-*", "runner")
+
+	tests := []struct {
+		name        string
+		document    string
+		subjects    []resolvedSubject
+		wantChanged bool
+		want        []string
+	}{
+		{
+			name:        "subject already trusted is not added again",
+			document:    testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{chaos.Subject})),
+			subjects:    []resolvedSubject{chaos},
+			wantChanged: false,
+			want:        []string{"StringEquals " + chaos.Subject},
+		},
+		{
+			name:        "subject is appended to the statement of the same provider",
+			document:    testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{chaos.Subject})),
+			subjects:    []resolvedSubject{other, other},
+			wantChanged: true,
+			want:        []string{"StringEquals " + chaos.Subject, "StringEquals " + other.Subject},
+		},
+		{
+			name:        "wildcard subject gets its own StringLike statement",
+			document:    testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{chaos.Subject})),
+			subjects:    []resolvedSubject{wildcard},
+			wantChanged: true,
+			want:        []string{"StringEquals " + chaos.Subject, "StringLike " + wildcard.Subject},
+		},
+		{
+			name: "statement of earlier versions with the subject as audience is replaced",
+			document: testTrustDocument(t, TrustStatement{
+				Effect:    "Allow",
+				Principal: TrustPrincipal{Federated: testProviderARN},
+				Action:    webIdentityAction,
+				Condition: map[string]map[string]interface{}{operatorEquals: {testIssuerHost + ":aud": chaos.Subject}},
+			}),
+			subjects:    []resolvedSubject{chaos},
+			wantChanged: true,
+			want:        []string{"StringEquals " + chaos.Subject},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, changed, err := AddTrustSubjects(tt.document, tt.subjects)
+			if err != nil {
+				t.Fatalf("AddTrustSubjects() unexpected err: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("AddTrustSubjects() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed && merged != tt.document {
+				t.Errorf("AddTrustSubjects() rewrote the unchanged document")
+			}
+			if got := trustedSubjects(t, merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AddTrustSubjects() trusts %v, want %v", got, tt.want)
+			}
+
+			// Adding the same subjects again must not change the document
+			again, changed, err := AddTrustSubjects(merged, tt.subjects)
+			if err != nil || changed || again != merged {
+				t.Errorf("AddTrustSubjects() isn't idempotent, changed = %v, err = %v", changed, err)
+			}
+		})
+	}
+}
+
+func TestRemoveTrustSubjects(t *testing.T) {
+
+	chaos := testSubject("hce", "litmus-admin")
+	other := testSubject("apps", "runner")
+	wildcard := testSubject("team-*", "runner")
+	sharedStatement := NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{chaos.Subject, other.Subject})
+	wildcardStatement := NewIRSAStatement(testProviderARN, testIssuerHost, operatorLike, []string{wildcard.Subject})
+
+	tests := []struct {
+		name        string
+		document    string
+		subjects    []resolvedSubject
+		wantChanged bool
+		want        []string
+		wantErr     string
+	}{
+		{
+			name:        "only the matching subject is removed",
+			document:    testTrustDocument(t, sharedStatement, wildcardStatement),
+			subjects:    []resolvedSubject{other},
+			wantChanged: true,
+			want:        []string{"StringEquals " + chaos.Subject, "StringLike " + wildcard.Subject},
+		},
+		{
+			name:        "wildcard subject is removed from the StringLike statement",
+			document:    testTrustDocument(t, sharedStatement, wildcardStatement),
+			subjects:    []resolvedSubject{wildcard},
+			wantChanged: true,
+			want:        []string{"StringEquals " + chaos.Subject, "StringEquals " + other.Subject},
+		},
+		{
+			name:     "wildcard subject doesn't remove the subjects it matches",
+			document: testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{chaos.Subject}), wildcardStatement),
+			subjects: []resolvedSubject{testSubject("*", "litmus-admin")},
+			want:     []string{"StringEquals " + chaos.Subject, "StringLike " + wildcard.Subject},
+		},
+		{
+			name:     "subject which isn't trusted leaves the document as is",
+			document: testTrustDocument(t, sharedStatement),
+			subjects: []resolvedSubject{wildcard},
+			want:     []string{"StringEquals " + chaos.Subject, "StringEquals " + other.Subject},
+		},
+		{
+			name:     "last subject can't be removed",
+			document: testTrustDocument(t, sharedStatement),
+			subjects: []resolvedSubject{chaos, other},
+			wantErr:  "refusing to remove the last subject trusted by the role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, changed, err := RemoveTrustSubjects(tt.document, tt.subjects)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RemoveTrustSubjects() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RemoveTrustSubjects() unexpected err: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("RemoveTrustSubjects() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed && merged != tt.document {
+				t.Errorf("RemoveTrustSubjects() rewrote the unchanged document")
+			}
+			if got := trustedSubjects(t, merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RemoveTrustSubjects() trusts %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "same text has only common lines",
+			before: "a\nb",
+			after:  "a\nb",
+			want:   "  a\n  b\n",
+		},
+		{
+			name:   "added line",
+			before: "a\nc",
+			after:  "a\nb\nc",
+			want:   "  a\n+ b\n  c\n",
+		},
+		{
+			name:   "removed line",
+			before: "a\nb\nc",
+			after:  "a\nc",
+			want:   "  a\n- b\n  c\n",
+		},
+		{
+			name:   "changed line",
+			before: "a\nb\nc",
+			after:  "a\nx\nc",
+			want:   "  a\n- b\n+ x\n  c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LineDiff(tt.before, tt.after); got != tt.want {
+				t.Errorf("LineDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
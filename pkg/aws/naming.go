@@ -0,0 +1,211 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+const (
+	// DefaultNameTemplate is the naming template of the role and policies, it keeps the names of the earlier versions
+	DefaultNameTemplate = "{{.Prefix}}-{{.Namespace}}"
+	// rolePrefix and policyPrefix are the prefixes of the chaos role and policy names
+	rolePrefix   = "HCERole"
+	policyPrefix = "HCEChaosPolicy"
+	// maxRoleNameLength and maxPolicyNameLength are the IAM limits of the role and policy names
+	maxRoleNameLength   = 64
+	maxPolicyNameLength = 128
+	// clusterTagKey is the tag holding the OIDC issuer of the cluster for which the aws resource is created
+	clusterTagKey = "hce.harness.io/cluster"
+)
+
+var (
+	iamNamePattern = regexp.MustCompile(`^[\w+=,.@-]+$`)
+	clusterPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+)
+
+// nameData is the data of the naming template
+type nameData struct {
+	Prefix    string
+	Cluster   string
+	Namespace string
+}
+
+// ChaosRoleName will return the name of the chaos role, either provided by the user or rendered by the naming template
+func ChaosRoleName(params types.OnboardingParameters) (string, error) {
+	if strings.TrimSpace(params.RoleName) != "" {
+		return params.RoleName, nil
+	}
+	return renderName(params, rolePrefix, maxRoleNameLength)
+}
+
+// PolicyName will return the name of the chaos policy document at the given index, rendered by the naming template.
+// The index is separated by an underscore, which the rendered name can't contain, so the names never collide.
+func PolicyName(params types.OnboardingParameters, index int) (string, error) {
+	// The index suffix of the split documents takes up to 3 characters
+	name, err := renderName(params, policyPrefix, maxPolicyNameLength-3)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(name, "_") {
+		return "", errors.Errorf("invalid policy name '%v' of the naming template, the underscore is reserved for the index of the split documents", name)
+	}
+	return documentName(name, index), nil
+}
+
+// documentName will return the name of the policy document at the given index for the name of the first document
+func documentName(name string, index int) string {
+	if index == 0 {
+		return name
+	}
+	return name + "_" + strconv.Itoa(index+1)
+}
+
+// isLegacyName will check if the name is the one the earlier versions of this cli, which didn't tag the resources
+// they created, gave to the role or policy of the given prefix for the infra namespace
+func isLegacyName(name, prefix string, params types.OnboardingParameters) bool {
+	return name == prefix+"-"+params.Infra.Namespace
+}
+
+// AdoptableRole will check if the role, which is not tagged as created by this cli, has the name the earlier
+// versions gave to the chaos role and is adopted instead of refused
+func AdoptableRole(roleName string, params types.OnboardingParameters) bool {
+	return strings.TrimSpace(params.RoleName) == "" && isLegacyName(roleName, rolePrefix, params)
+}
+
+// ValidateNaming will check that the naming template renders valid IAM names for the role and policies
+func ValidateNaming(params types.OnboardingParameters) error {
+	if _, err := ChaosRoleName(params); err != nil {
+		return err
+	}
+	_, err := PolicyName(params, 0)
+	return err
+}
+
+// renderName will render the naming template for the resource prefix and check the name against the IAM rules
+func renderName(params types.OnboardingParameters, prefix string, maxLength int) (string, error) {
+
+	text := params.Naming.Template
+	if strings.TrimSpace(text) == "" {
+		text = DefaultNameTemplate
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Errorf("invalid naming template '%v', err: %v", text, err)
+	}
+	if strings.Contains(text, ".Cluster") {
+		if params.Naming.Cluster == "" {
+			return "", errors.Errorf("the naming template '%v' uses the cluster, set it with --cluster-name", text)
+		}
+		if !clusterPattern.MatchString(params.Naming.Cluster) {
+			return "", errors.Errorf("invalid cluster name '%v', expected letters, digits and hyphens", params.Naming.Cluster)
+		}
+	}
+
+	var name bytes.Buffer
+	data := nameData{Prefix: prefix, Cluster: params.Naming.Cluster, Namespace: params.Infra.Namespace}
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", errors.Errorf("invalid naming template '%v', err: %v", text, err)
+	}
+	switch {
+	case !iamNamePattern.MatchString(name.String()):
+		return "", errors.Errorf("invalid name '%v' of the naming template, IAM names only contain letters, digits and +=,.@_-", name.String())
+	case len(name.String()) > maxLength:
+		return "", errors.Errorf("the name '%v' of the naming template has %v characters, which exceeds the limit of %v", name.String(), name.Len(), maxLength)
+	}
+	return name.String(), nil
+}
+
+// clusterIdentity will return the OIDC issuer of the cluster, without the scheme, which identifies the cluster the
+// aws resources are created for
+func clusterIdentity(params types.OnboardingParameters) string {
+	if strings.TrimSpace(params.ProviderUrl) == "" {
+		return ""
+	}
+	return normalizeIssuer(params.ProviderUrl)
+}
+
+// checkCluster will check that the tags don't mark the resource as created for another cluster
+func checkCluster(resource string, tags []*iam.Tag, params types.OnboardingParameters) error {
+	identity := clusterIdentity(params)
+	if identity == "" {
+		return nil
+	}
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == clusterTagKey && aws.StringValue(tag.Value) != identity {
+			return errors.Errorf("the %v belongs to the cluster of OIDC issuer '%v', not '%v'. Use a naming template with {{.Cluster}} and --cluster-name to give each cluster its own resources", resource, aws.StringValue(tag.Value), identity)
+		}
+	}
+	return nil
+}
+
+// CheckRoleCluster will check that the chaos role, if it exists and was created by this cli, belongs to the cluster
+// of the params. A role created before the cluster tag is checked through the OIDC providers it trusts. The role
+// provided by the user can be shared between clusters and is not checked.
+func CheckRoleCluster(params types.OnboardingParameters) error {
+
+	if strings.TrimSpace(params.RoleName) != "" || clusterIdentity(params) == "" {
+		return nil
+	}
+	roleName, err := ChaosRoleName(params)
+	if err != nil {
+		return err
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	if !isManaged(role.Role.Tags) {
+		return nil
+	}
+	if err := checkCluster("role '"+roleName+"'", role.Role.Tags, params); err != nil {
+		return err
+	}
+	for _, tag := range role.Role.Tags {
+		if aws.StringValue(tag.Key) == clusterTagKey {
+			return nil
+		}
+	}
+
+	document, err := GetTrustPolicy(roleName, params)
+	if err != nil {
+		return err
+	}
+	statements, err := trustStatements(document)
+	if err != nil {
+		return err
+	}
+	identity := clusterIdentity(params)
+	for _, statement := range statements {
+		var principal struct {
+			Federated json.RawMessage
+		}
+		if err := json.Unmarshal(statement.Principal, &principal); err != nil || len(principal.Federated) == 0 {
+			continue
+		}
+		providers, _ := stringOrSlice(principal.Federated)
+		for _, provider := range providers {
+			if strings.HasSuffix(provider, ":oidc-provider/"+identity) {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("the role '%v' doesn't trust the OIDC issuer '%v' and belongs to another cluster. Use a naming template with {{.Cluster}} and --cluster-name to give each cluster its own resources", roleName, identity)
+}
@@ -0,0 +1,163 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// testNamingParams will return the params of the infra namespace with the given naming
+func testNamingParams(namespace, template, cluster string) types.OnboardingParameters {
+	var params types.OnboardingParameters
+	params.Infra.Namespace = namespace
+	params.Naming.Template = template
+	params.Naming.Cluster = cluster
+	return params
+}
+
+func TestNames(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		params     types.OnboardingParameters
+		wantRole   string
+		wantPolicy string
+		wantErr    string
+	}{
+		{
+			name:       "default template keeps the names of the earlier versions",
+			params:     testNamingParams("hce", "", ""),
+			wantRole:   "HCERole-hce",
+			wantPolicy: "HCEChaosPolicy-hce",
+		},
+		{
+			name:       "template with the cluster",
+			params:     testNamingParams("hce", "{{.Prefix}}-{{.Cluster}}-{{.Namespace}}", "prod-east"),
+			wantRole:   "HCERole-prod-east-hce",
+			wantPolicy: "HCEChaosPolicy-prod-east-hce",
+		},
+		{
+			name:    "template with the cluster but no cluster name",
+			params:  testNamingParams("hce", "{{.Prefix}}-{{.Cluster}}-{{.Namespace}}", ""),
+			wantErr: "uses the cluster, set it with --cluster-name",
+		},
+		{
+			name:    "invalid cluster name",
+			params:  testNamingParams("hce", "{{.Prefix}}-{{.Cluster}}", "prod_east"),
+			wantErr: "invalid cluster name 'prod_east'",
+		},
+		{
+			name:    "template which doesn't parse",
+			params:  testNamingParams("hce", "{{.Prefix", ""),
+			wantErr: "invalid naming template '{{.Prefix'",
+		},
+		{
+			name:    "template with an unknown field",
+			params:  testNamingParams("hce", "{{.Prefix}}-{{.Region}}", ""),
+			wantErr: "invalid naming template '{{.Prefix}}-{{.Region}}'",
+		},
+		{
+			name:    "name with a character IAM doesn't allow",
+			params:  testNamingParams("hce", "{{.Prefix}}/{{.Namespace}}", ""),
+			wantErr: "IAM names only contain letters, digits and +=,.@_-",
+		},
+		{
+			name:    "role name over the length limit",
+			params:  testNamingParams(strings.Repeat("n", maxRoleNameLength-len("HCERole-")+1), "", ""),
+			wantErr: "which exceeds the limit of 64",
+		},
+		{
+			name:    "underscore reserved for the index of the split documents",
+			params:  testNamingParams("hce", "{{.Prefix}}_{{.Namespace}}", ""),
+			wantErr: "the underscore is reserved for the index of the split documents",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNaming(tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ValidateNaming() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateNaming() unexpected err: %v", err)
+			}
+			if role, _ := ChaosRoleName(tt.params); role != tt.wantRole {
+				t.Errorf("ChaosRoleName() = %v, want %v", role, tt.wantRole)
+			}
+			if policy, _ := PolicyName(tt.params, 0); policy != tt.wantPolicy {
+				t.Errorf("PolicyName() = %v, want %v", policy, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestPolicyName(t *testing.T) {
+
+	// The longest namespace whose policy name fits along with the index suffix
+	longest := strings.Repeat("n", maxPolicyNameLength-3-len("HCEChaosPolicy-"))
+	userRole := testNamingParams("hce", "", "")
+	userRole.RoleName = "custom"
+
+	tests := []struct {
+		name    string
+		params  types.OnboardingParameters
+		index   int
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "first document has no suffix",
+			params: testNamingParams("hce", "", ""),
+			index:  0,
+			want:   "HCEChaosPolicy-hce",
+		},
+		{
+			name:   "split documents are suffixed with their position",
+			params: testNamingParams("hce", "", ""),
+			index:  1,
+			want:   "HCEChaosPolicy-hce_2",
+		},
+		{
+			name:   "last document of the attachment quota",
+			params: testNamingParams(longest, "", ""),
+			index:  maxAttachedPolicies - 1,
+			want:   "HCEChaosPolicy-" + longest + "_10",
+		},
+		{
+			name:    "room is kept for the suffix",
+			params:  testNamingParams(longest+"n", "", ""),
+			wantErr: "which exceeds the limit of 125",
+		},
+		{
+			name:   "role provided by the user doesn't change the policy name",
+			params: userRole,
+			want:   "HCEChaosPolicy-hce",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := PolicyName(tt.params, tt.index)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PolicyName() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PolicyName() unexpected err: %v", err)
+			}
+			if name != tt.want {
+				t.Errorf("PolicyName() = %v, want %v", name, tt.want)
+			}
+			if len(name) > maxPolicyNameLength {
+				t.Errorf("PolicyName() has %v characters, which exceeds the limit of %v", len(name), maxPolicyNameLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package aws
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	hce_types "github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// OIDCProviderPlan describes the OIDC provider which will be connected to the aws account
+type OIDCProviderPlan struct {
+	URL           string   `json:"url"`
+	Thumbprint    string   `json:"thumbprint"`
+	ClientIDs     []string `json:"clientIDs"`
+	ARN           string   `json:"arn"`
+	AlreadyExists bool     `json:"alreadyExists"`
+	Changes       []string `json:"changes,omitempty"`
+}
+
+// PlanOIDCProvider will describe the OIDC provider for the given provider URL without creating it
+func PlanOIDCProvider(params hce_types.OnboardingParameters, accountID string) (OIDCProviderPlan, error) {
+
+	thumbprint, err := getThumbprint(params)
+	if err != nil {
+		return OIDCProviderPlan{}, errors.Errorf("failed to compute the thumbprint, err: %v", err)
+	}
+
+	plan := OIDCProviderPlan{
+		URL:        params.ProviderUrl,
+		Thumbprint: thumbprint,
+		ClientIDs:  []string{stsAudience},
+		ARN:        ProviderARN(accountID, params.ProviderUrl),
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return plan, err
+	}
+	provider, err := findProvider(iam.New(sess), params.ProviderUrl)
+	if err != nil || provider == nil {
+		return plan, err
+	}
+	plan.ARN = provider.ARN
+	plan.ClientIDs = provider.ClientIDs
+	plan.AlreadyExists = true
+
+	missingClientID, thumbprints := providerChanges(*provider, thumbprint)
+	if missingClientID {
+		plan.Changes = append(plan.Changes, "add the client ID "+stsAudience)
+	}
+	if thumbprints != nil {
+		plan.Changes = append(plan.Changes, "update the thumbprint list from "+listOrNone(provider.Thumbprints)+" to "+strings.Join(thumbprints, ", "))
+	}
+	return plan, nil
+}
+
+// RoleExists will check if a role with the given name exists, and if it was created by this cli
+func RoleExists(params hce_types.OnboardingParameters, roleName string) (bool, bool, error) {
+
+	sess, err := Session(params)
+	if err != nil {
+		return false, false, err
+	}
+	svc := iam.New(sess)
+
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		if isNotFound(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return true, isManaged(role.Role.Tags), nil
+}
+
+// ProviderARN will return the ARN of the OIDC provider for the given URL in the given account, the URL is normalized
+// as IAM stores the providers
+func ProviderARN(accountID, providerURL string) string {
+	return "arn:aws:iam::" + accountID + ":oidc-provider/" + normalizeIssuer(providerURL)
+}
+
+// RoleARN will return the ARN of the given role under the IAM path in the given account
+func RoleARN(accountID, path, roleName string) string {
+	return "arn:aws:iam::" + accountID + ":role" + iamPathPrefix(path) + roleName
+}
+
+// PolicyARN will return the ARN of the given customer managed policy under the IAM path in the given account
+func PolicyARN(accountID, path, policyName string) string {
+	return "arn:aws:iam::" + accountID + ":policy" + iamPathPrefix(path) + policyName
+}
+
+// iamPathPrefix will return the IAM path as it appears in an ARN, the root path when none is given
+func iamPathPrefix(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -2,142 +2,267 @@ package aws
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/litmuschaos/litmus-go/pkg/cloud/aws/common"
 	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
 )
 
-// PreparePolicyAndCreateRole will prepare a policy JSON based on the target resource provided
-func PreparePolicyAndCreateRole(params types.OnboardingParameters) error {
+const (
+	// maxPolicySize is the maximum number of characters of a managed policy document, without whitespace
+	maxPolicySize = 6144
+	// maxAttachedPolicies is the default quota of managed policies attached to a role
+	maxAttachedPolicies = 10
+)
 
-	policyName := "HCEChaosPolicy-" + params.Infra.Namespace
+// PreparePolicy will prepare the policy documents based on the target resource provided. The mutating actions are
+// restricted to the policy scope and denied on the resources protected by the guardrails. The policy is split
+// across multiple documents when it exceeds the size limit of a managed policy, an inline policy is never split.
+func PreparePolicy(params types.OnboardingParameters) ([]Policy, error) {
 
 	log.Info("[Info]: Preparing policy for the role")
-	resources := strings.Split(params.Resources, ",")
+	registry, err := NewRegistry(params.PolicyCatalog)
+	if err != nil {
+		return nil, err
+	}
+	combinedPolicy, err := registry.Build(params.Resources, params.Faults)
+	if err != nil {
+		return nil, err
+	}
+	combinedPolicy, err = registry.ScopePolicy(combinedPolicy, params.Scope)
+	if err != nil {
+		return nil, err
+	}
+	guardrails, err := registry.Guardrails(combinedPolicy, params.Guardrails)
+	if err != nil {
+		return nil, err
+	}
+	if combinedPolicy, err = ApplyGuardrails(combinedPolicy, guardrails); err != nil {
+		return nil, err
+	}
 
-	// Prepare combined policy
-	combinedPolicy := Policy{Version: "2012-10-17"}
-	actionSet := make(map[string]bool)
-	for _, resource := range resources {
-		switch resource {
-		case "ec2":
-			for _, stmt := range ec2Policy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "lambda":
-			for _, stmt := range lambdaPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "aws-access-restrict":
-			for _, stmt := range awsAccessRestrictPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "az":
-			for _, stmt := range azPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "ebs":
-			for _, stmt := range ebsPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "ec2-state":
-			for _, stmt := range ec2StatePolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "ecs-ec2":
-			for _, stmt := range ecsEc2Policy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "ecs-fargate":
-			for _, stmt := range ecsFargatePolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "ecs-state":
-			for _, stmt := range ecsStatePolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "lambda-permission":
-			for _, stmt := range lambdaPermissionPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "rds":
-			for _, stmt := range rdsPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "windows":
-			for _, stmt := range windowsPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
-				}
-			}
-		case "all":
-			for _, stmt := range allPolicy.Statement {
-				for _, action := range stmt.Action {
-					actionSet[action] = true
+	policies, err := splitChaosPolicy(combinedPolicy, params)
+	if err != nil {
+		return nil, err
+	}
+	for i, policy := range policies {
+		policyJson, err := json.MarshalIndent(policy, "", "  ")
+		if err != nil {
+			return nil, errors.Errorf("failed to prepare policy JSON, err: %v", err)
+		}
+		size, err := PolicySize(policy)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("[Info]: Policy document %v of %v, %v characters", i+1, len(policies), size)
+		log.Info(string(policyJson))
+	}
+	return policies, nil
+}
+
+// Build will merge the policies of the given comma separated resource groups and faults of the catalog. The actions
+// of the statements with the same effect, resources and conditions are grouped into one statement per service,
+// sorted so the same selection always gives the same policy.
+func (r *Registry) Build(resourceGroups, faults string) (Policy, error) {
+
+	groups, faultGroups, err := r.selection(resourceGroups, faults)
+	if err != nil {
+		return Policy{}, err
+	}
+	groups = append(groups, faultGroups...)
+
+	// Group the actions by statement and service
+	type statementGroup struct {
+		service   string
+		key       string
+		statement Statement
+		actions   map[string]bool
+	}
+	merged := map[string]*statementGroup{}
+	for _, group := range groups {
+		for _, stmt := range group.Statements {
+			key := statementKey(stmt)
+			for _, action := range stmt.Action {
+				service := strings.SplitN(action, ":", 2)[0]
+				if merged[service+key] == nil {
+					merged[service+key] = &statementGroup{service: service, key: key, statement: stmt, actions: map[string]bool{}}
 				}
+				merged[service+key].actions[action] = true
 			}
-		default:
-			return errors.Errorf("unknown resource type: %v", resource)
 		}
 	}
 
-	for action := range actionSet {
-		combinedPolicy.Statement = append(combinedPolicy.Statement, Statement{Effect: "Allow", Action: []string{action}, Resource: "*"})
+	var statementGroups []*statementGroup
+	for _, group := range merged {
+		statementGroups = append(statementGroups, group)
+	}
+	sort.Slice(statementGroups, func(i, j int) bool {
+		if statementGroups[i].service != statementGroups[j].service {
+			return statementGroups[i].service < statementGroups[j].service
+		}
+		return statementGroups[i].key < statementGroups[j].key
+	})
+
+	// Prepare combined policy
+	combinedPolicy := Policy{Version: "2012-10-17"}
+	for _, group := range statementGroups {
+		var actions []string
+		for action := range group.actions {
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+		combinedPolicy.Statement = append(combinedPolicy.Statement, Statement{
+			Effect:    group.statement.Effect,
+			Action:    actions,
+			Resource:  group.statement.Resource,
+			Condition: group.statement.Condition,
+		})
 	}
 
-	policyJson, err := json.MarshalIndent(combinedPolicy, "", "  ")
+	return combinedPolicy, nil
+}
+
+// PolicySize will return the number of characters of the minified policy document, as counted against the limit
+func PolicySize(policy Policy) (int, error) {
+	policyDoc, err := json.Marshal(policy)
 	if err != nil {
-		return errors.Errorf("failed to prepare policy JSON, err: %v", err)
+		return 0, errors.Errorf("failed to prepare policy JSON, err: %v", err)
+	}
+	return len(policyDoc), nil
+}
+
+// SplitPolicy will split the policy into as few documents as needed to keep each one within the size limit
+// of a managed policy, a statement is split by actions when it doesn't fit in a document on its own
+func SplitPolicy(policy Policy) ([]Policy, error) {
+
+	var statements []Statement
+	for _, stmt := range policy.Statement {
+		split, err := splitStatement(policy.Version, stmt)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, split...)
 	}
-	log.Info(string(policyJson))
 
-	if !params.Dryrun {
+	var policies []Policy
+	current := Policy{Version: policy.Version}
+	for _, stmt := range statements {
+		candidate := Policy{Version: policy.Version, Statement: append(append([]Statement{}, current.Statement...), stmt)}
+		size, err := PolicySize(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxPolicySize && len(current.Statement) != 0 {
+			policies = append(policies, current)
+			current = Policy{Version: policy.Version, Statement: []Statement{stmt}}
+			continue
+		}
+		current = candidate
+	}
+	policies = append(policies, current)
 
-		policyARN, err := createPolicy(combinedPolicy, policyName, params.Region)
+	if len(policies) > maxAttachedPolicies {
+		return nil, errors.Errorf("the policy needs %v documents, which exceeds the quota of %v managed policies per role", len(policies), maxAttachedPolicies)
+	}
+	return policies, nil
+}
+
+// splitChaosPolicy will split the chaos policy into the documents of the role, keeping room for the managed
+// policies attached along with it
+func splitChaosPolicy(policy Policy, params types.OnboardingParameters) ([]Policy, error) {
+
+	if params.IAM.InlinePolicy {
+		size, err := PolicySize(policy)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		if size > maxInlinePolicySize {
+			return nil, errors.Errorf("the policy has %v characters which exceeds the limit of %v characters of the inline policies of a role, use managed policies instead", size, maxInlinePolicySize)
+		}
+		return []Policy{policy}, nil
+	}
+
+	policies, err := SplitPolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if attached := len(splitNames(params.IAM.ManagedPolicyARNs)); len(policies)+attached > maxAttachedPolicies {
+		return nil, errors.Errorf("the policy needs %v documents which along with the %v attached policies exceeds the quota of %v managed policies per role", len(policies), attached, maxAttachedPolicies)
+	}
+	return policies, nil
+}
+
+// splitStatement will halve the actions of the statement until each part fits in a policy document on its own
+func splitStatement(version string, stmt Statement) ([]Statement, error) {
+	size, err := PolicySize(Policy{Version: version, Statement: []Statement{stmt}})
+	if err != nil {
+		return nil, err
+	}
+	if size <= maxPolicySize {
+		return []Statement{stmt}, nil
+	}
+	if len(stmt.Action) <= 1 {
+		return nil, errors.Errorf("the statement of action %v exceeds the policy size limit of %v characters", stmt.Action, maxPolicySize)
+	}
+	half := len(stmt.Action) / 2
+	first, err := splitStatement(version, Statement{Effect: stmt.Effect, Action: stmt.Action[:half], Resource: stmt.Resource, Condition: stmt.Condition})
+	if err != nil {
+		return nil, err
+	}
+	second, err := splitStatement(version, Statement{Effect: stmt.Effect, Action: stmt.Action[half:], Resource: stmt.Resource, Condition: stmt.Condition})
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// CreatePolicies will create the chaos policy documents for the infra namespace and return their ARNs, the
+// existing policies get a new default version when their document differs. The untagged policy of an earlier
+// version of this cli is tagged first.
+func CreatePolicies(policies []Policy, params types.OnboardingParameters) ([]string, error) {
 
-		log.Infof("[Info]: The policy is successfully created")
-		if err := CreateRoleWithTrustRelationsip(policyARN, params); err != nil {
-			return errors.Errorf("failed to create role, err: %v", err)
+	updates, err := PlanPolicyUpdates(policies, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var policyARNs []string
+	for i, update := range updates {
+		if update.Adopt {
+			if err := adoptPolicy(update, params); err != nil {
+				return nil, err
+			}
 		}
+		switch {
+		case !update.Exists:
+			if _, err := createPolicy(policies[i], update.PolicyName, params); err != nil {
+				return nil, err
+			}
+		case !update.Changed:
+			log.Infof("[Info]: The policy '%v' is already up to date", update.PolicyName)
+		default:
+			if err := updatePolicy(update, params); err != nil {
+				return nil, err
+			}
+		}
+		policyARNs = append(policyARNs, update.PolicyARN)
 	}
-	return nil
+	log.Infof("[Info]: The policy is successfully created")
+	return policyARNs, nil
 }
 
 // createPolicy will create the given policy
-func createPolicy(policy Policy, policyName, region string) (string, error) {
+func createPolicy(policy Policy, policyName string, params types.OnboardingParameters) (string, error) {
 
 	// Load session from shared config
-	sess := common.GetAWSSession(region)
+	sess, err := Session(params)
+	if err != nil {
+		return "", err
+	}
 
 	// Create IAM service client
 	svc := iam.New(sess)
@@ -152,9 +277,12 @@ func createPolicy(policy Policy, policyName, region string) (string, error) {
 	resp, err := svc.CreatePolicy(&iam.CreatePolicyInput{
 		PolicyDocument: aws.String(string(policyDoc)),
 		PolicyName:     aws.String(policyName),
+		Path:           aws.String(iamPathPrefix(params.IAM.Path)),
+		Description:    optionalString(params.IAM.Description),
+		Tags:           resourceTags(params),
 	})
 	if err != nil {
-		return "", errors.Errorf("Error marshaling policy document: %v", err)
+		return "", iamError("create policy '"+policyName+"'", err)
 	}
 
 	log.Info("[Indo]: Policy successfully created.")
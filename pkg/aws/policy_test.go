@@ -0,0 +1,309 @@
+package aws
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// testActions will return count actions of the service, each padded to width characters
+func testActions(service string, count, width int) []string {
+	var actions []string
+	for i := 0; i < count; i++ {
+		action := fmt.Sprintf("%v:Action%04d", service, i)
+		actions = append(actions, action+strings.Repeat("x", width-len(action)))
+	}
+	return actions
+}
+
+// testStatement will return an allow statement of the actions on every resource
+func testStatement(actions []string) Statement {
+	return Statement{Effect: "Allow", Action: actions, Resource: []string{"*"}}
+}
+
+// testPolicy will return a policy of the given statements
+func testPolicy(statements ...Statement) Policy {
+	return Policy{Version: "2012-10-17", Statement: statements}
+}
+
+func TestSplitPolicy(t *testing.T) {
+
+	var manyStatements []Statement
+	for i := 0; i < maxAttachedPolicies+1; i++ {
+		manyStatements = append(manyStatements, testStatement(testActions(fmt.Sprintf("svc%02d", i), 100, 40)))
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		wantDocs int
+		wantErr  string
+	}{
+		{
+			name:     "small policy stays in one document",
+			policy:   testPolicy(testStatement([]string{"ec2:StartInstances", "ec2:StopInstances"})),
+			wantDocs: 1,
+		},
+		{
+			name:     "statements which fit together stay in one document",
+			policy:   testPolicy(testStatement(testActions("ec2", 60, 40)), testStatement(testActions("rds", 60, 40))),
+			wantDocs: 1,
+		},
+		{
+			name:     "statements over the size threshold go to separate documents",
+			policy:   testPolicy(testStatement(testActions("ec2", 90, 40)), testStatement(testActions("rds", 90, 40))),
+			wantDocs: 2,
+		},
+		{
+			name:     "oversized statement is split by actions",
+			policy:   testPolicy(testStatement(testActions("ec2", 400, 40))),
+			wantDocs: 4,
+		},
+		{
+			name:    "single action over the size limit",
+			policy:  testPolicy(testStatement(testActions("ec2", 1, maxPolicySize))),
+			wantErr: "exceeds the policy size limit",
+		},
+		{
+			name:    "documents over the attachment quota",
+			policy:  testPolicy(manyStatements...),
+			wantErr: "exceeds the quota of 10 managed policies per role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := SplitPolicy(tt.policy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SplitPolicy() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SplitPolicy() unexpected err: %v", err)
+			}
+			if len(policies) != tt.wantDocs {
+				t.Fatalf("SplitPolicy() gave %v documents, want %v", len(policies), tt.wantDocs)
+			}
+
+			var got, want []string
+			for _, policy := range policies {
+				size, err := PolicySize(policy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > maxPolicySize {
+					t.Errorf("document of %v characters exceeds the limit of %v", size, maxPolicySize)
+				}
+				for _, stmt := range policy.Statement {
+					got = append(got, stmt.Action...)
+				}
+			}
+			for _, stmt := range tt.policy.Statement {
+				want = append(want, stmt.Action...)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SplitPolicy() didn't keep the actions in order, got %v actions, want %v", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestSplitStatement(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		stmt    Statement
+		wantLen int
+		wantErr bool
+	}{
+		{
+			name:    "statement within the limit is kept",
+			stmt:    testStatement(testActions("ec2", 10, 40)),
+			wantLen: 1,
+		},
+		{
+			name:    "statement twice over the limit is halved",
+			stmt:    testStatement(testActions("ec2", 200, 40)),
+			wantLen: 2,
+		},
+		{
+			name:    "halves still over the limit are halved again",
+			stmt:    testStatement(testActions("ec2", 400, 40)),
+			wantLen: 4,
+		},
+		{
+			name:    "single action over the limit",
+			stmt:    testStatement(testActions("ec2", 1, maxPolicySize)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := splitStatement("2012-10-17", tt.stmt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitStatement() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(statements) != tt.wantLen {
+				t.Fatalf("splitStatement() gave %v statements, want %v", len(statements), tt.wantLen)
+			}
+			for _, stmt := range statements {
+				if stmt.Effect != tt.stmt.Effect || !reflect.DeepEqual(stmt.Resource, tt.stmt.Resource) {
+					t.Errorf("splitStatement() changed the effect or resources of the statement")
+				}
+				size, err := PolicySize(testPolicy(stmt))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > maxPolicySize {
+					t.Errorf("statement of %v characters exceeds the limit of %v", size, maxPolicySize)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitChaosPolicy(t *testing.T) {
+
+	twoDocuments := testPolicy(testStatement(testActions("ec2", 90, 40)), testStatement(testActions("rds", 90, 40)))
+	arns := func(count int) string {
+		var result []string
+		for i := 0; i < count; i++ {
+			result = append(result, fmt.Sprintf("arn:aws:iam::123456789012:policy/extra-%v", i))
+		}
+		return strings.Join(result, ",")
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		iam      types.IAMOptions
+		wantDocs int
+		wantErr  string
+	}{
+		{
+			name:     "managed policies within the quota",
+			policy:   twoDocuments,
+			iam:      types.IAMOptions{ManagedPolicyARNs: arns(maxAttachedPolicies - 2)},
+			wantDocs: 2,
+		},
+		{
+			name:    "attached managed policies count against the quota",
+			policy:  twoDocuments,
+			iam:     types.IAMOptions{ManagedPolicyARNs: arns(maxAttachedPolicies - 1)},
+			wantErr: "along with the 9 attached policies",
+		},
+		{
+			name:     "inline policy is never split",
+			policy:   twoDocuments,
+			iam:      types.IAMOptions{InlinePolicy: true},
+			wantDocs: 1,
+		},
+		{
+			name:    "inline policy over the inline size limit",
+			policy:  testPolicy(testStatement(testActions("ec2", 300, 40))),
+			iam:     types.IAMOptions{InlinePolicy: true},
+			wantErr: "use managed policies instead",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := splitChaosPolicy(tt.policy, types.OnboardingParameters{IAM: tt.iam})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitChaosPolicy() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitChaosPolicy() unexpected err: %v", err)
+			}
+			if len(policies) != tt.wantDocs {
+				t.Errorf("splitChaosPolicy() gave %v documents, want %v", len(policies), tt.wantDocs)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		resourceGroups string
+		faults         string
+		reordered      string
+		wantErr        string
+	}{
+		{
+			name:           "single resource group",
+			resourceGroups: "ec2-state",
+			reordered:      "ec2-state,ec2-state",
+		},
+		{
+			name:           "resource groups in any order along with a fault",
+			resourceGroups: "ec2-state,ebs",
+			faults:         "rds-instance-reboot",
+			reordered:      "ebs, ec2-state",
+		},
+		{
+			name:           "unknown resource group",
+			resourceGroups: "no-such-group",
+			wantErr:        "unknown resource type: no-such-group",
+		},
+		{
+			name:    "nothing selected",
+			wantErr: "no resources or faults provided",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := registry.Build(tt.resourceGroups, tt.faults)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() unexpected err: %v", err)
+			}
+			if len(policy.Statement) == 0 {
+				t.Fatalf("Build() gave an empty policy")
+			}
+			for _, stmt := range policy.Statement {
+				for i := 1; i < len(stmt.Action); i++ {
+					if stmt.Action[i-1] >= stmt.Action[i] {
+						t.Errorf("Build() actions aren't sorted and unique: %v", stmt.Action)
+					}
+				}
+			}
+
+			again, err := registry.Build(tt.resourceGroups, tt.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reordered, err := registry.Build(tt.reordered, tt.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(policy, again) || !reflect.DeepEqual(policy, reordered) {
+				t.Errorf("Build() isn't deterministic for the same selection")
+			}
+		})
+	}
+}
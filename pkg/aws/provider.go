@@ -1,27 +1,30 @@
 package aws
 
 import (
-	"crypto/sha1"
-	"crypto/tls"
-	"encoding/hex"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/litmuschaos/litmus-go/pkg/cloud/aws/common"
 	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/pkg/errors"
 	hce_types "github.com/uditgaurav/onboard_hce_aws/pkg/types"
 )
 
-// ConnectOIDCProvider will connect the provided OIDC provider in the AWS account
-func ConnectOIDCProvider(onboardingParams hce_types.OnboardingParameters) (string, error) {
+const (
+	// providerLookupWorkers is the number of OIDC provider details fetched in parallel
+	providerLookupWorkers = 8
+	// maxThumbprints is the maximum number of thumbprints of an OIDC provider
+	maxThumbprints = 5
+)
 
-	clientID := "sts.amazonaws.com"
-	var providerArn string
+// ConnectOIDCProvider will connect the provided OIDC provider in the AWS account. An existing provider is reused,
+// after adding the sts.amazonaws.com client ID and the thumbprint of the issuer when they are missing.
+func ConnectOIDCProvider(onboardingParams hce_types.OnboardingParameters) (string, error) {
 
-	thumbprint, err := getThumbprint(onboardingParams.ProviderUrl)
+	thumbprint, err := getThumbprint(onboardingParams)
 	if err != nil {
 		return "", err
 	}
@@ -29,83 +32,188 @@ func ConnectOIDCProvider(onboardingParams hce_types.OnboardingParameters) (strin
 	log.Info("[Info]: The thumbprint is created successfully")
 
 	// Load session from shared config
-	sess := common.GetAWSSession(onboardingParams.Region)
+	sess, err := Session(onboardingParams)
+	if err != nil {
+		return "", err
+	}
 
 	svc := iam.New(sess)
+	provider, err := findProvider(svc, onboardingParams.ProviderUrl)
+	if err != nil {
+		return "", err
+	}
+	if provider != nil {
+		log.Infof("[Info]: The OIDC provider already exists with ARN: %v", provider.ARN)
+		return provider.ARN, updateProvider(svc, *provider, thumbprint)
+	}
+
 	params := &iam.CreateOpenIDConnectProviderInput{
 		Url: aws.String(onboardingParams.ProviderUrl),
 		ThumbprintList: []*string{
 			aws.String(thumbprint),
 		},
 		ClientIDList: []*string{
-			aws.String(clientID),
+			aws.String(stsAudience),
 		},
+		Tags: resourceTags(onboardingParams),
 	}
 
 	result, err := svc.CreateOpenIDConnectProvider(params)
 	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
+		// The provider can be created concurrently by another onboarding of the same cluster
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iam.ErrCodeEntityAlreadyExistsException {
 			log.Warnf("[Warning]: %v", err)
-			arn, err := getProviderArn(onboardingParams.ProviderUrl, onboardingParams.Region)
-			if err != nil {
+			if provider, err = findProvider(svc, onboardingParams.ProviderUrl); err != nil || provider == nil {
 				return "", errors.Errorf("Error getting OIDC provider ARN: %v", err)
 			}
-			log.Infof("[Info]: The providerARN for the given URL is: %v", arn)
-			providerArn = arn
-		} else {
-			return "", errors.Errorf("Error creating OIDC provider: %v", err)
+			log.Infof("[Info]: The providerARN for the given URL is: %v", provider.ARN)
+			return provider.ARN, updateProvider(svc, *provider, thumbprint)
+		}
+		return "", iamError("create OIDC provider", err)
+	}
+	log.Infof("[Info]: OIDC provider created with ARN: %v", *result.OpenIDConnectProviderArn)
+	return *result.OpenIDConnectProviderArn, nil
+}
+
+// oidcProvider is an OIDC provider of the aws account with its client IDs and thumbprints
+type oidcProvider struct {
+	ARN         string
+	Issuer      string
+	ClientIDs   []string
+	Thumbprints []string
+}
+
+// providerChanges will return whether the sts.amazonaws.com client ID is missing from the provider and the new
+// thumbprint list when the thumbprint of the issuer is missing, the thumbprint is put first and the list is kept
+// within its limit of 5 thumbprints
+func providerChanges(provider oidcProvider, thumbprint string) (bool, []string) {
+
+	missingClientID := !contains(provider.ClientIDs, stsAudience)
+	for _, existing := range provider.Thumbprints {
+		if strings.EqualFold(existing, thumbprint) {
+			return missingClientID, nil
+		}
+	}
+	thumbprints := []string{thumbprint}
+	for _, existing := range provider.Thumbprints {
+		if len(thumbprints) == maxThumbprints {
+			break
 		}
-	} else {
-		log.Infof("[Info]: OIDC provider created with ARN: %v", *result.OpenIDConnectProviderArn)
-		providerArn = *result.OpenIDConnectProviderArn
+		thumbprints = append(thumbprints, existing)
 	}
-	return providerArn, nil
+	return missingClientID, thumbprints
 }
 
-// getThumbprint will create the thumbprint for the given provider URL
-func getThumbprint(urlStr string) (string, error) {
-	parsedUrl, err := url.Parse(urlStr)
+// updateProvider will add the missing client ID and thumbprint to the existing OIDC provider
+func updateProvider(svc *iam.IAM, provider oidcProvider, thumbprint string) error {
+
+	missingClientID, thumbprints := providerChanges(provider, thumbprint)
+	if missingClientID {
+		if _, err := svc.AddClientIDToOpenIDConnectProvider(&iam.AddClientIDToOpenIDConnectProviderInput{
+			ClientID:                 aws.String(stsAudience),
+			OpenIDConnectProviderArn: aws.String(provider.ARN),
+		}); err != nil {
+			return iamError("add the client ID "+stsAudience+" to OIDC provider '"+provider.ARN+"'", err)
+		}
+		log.Infof("[Info]: The client ID %v is added to OIDC provider '%v'", stsAudience, provider.ARN)
+	}
+	if thumbprints != nil {
+		if _, err := svc.UpdateOpenIDConnectProviderThumbprint(&iam.UpdateOpenIDConnectProviderThumbprintInput{
+			OpenIDConnectProviderArn: aws.String(provider.ARN),
+			ThumbprintList:           aws.StringSlice(thumbprints),
+		}); err != nil {
+			return iamError("update the thumbprints of OIDC provider '"+provider.ARN+"'", err)
+		}
+		log.Infof("[Info]: The thumbprint list of OIDC provider '%v' is updated from %v to %v", provider.ARN, listOrNone(provider.Thumbprints), strings.Join(thumbprints, ", "))
+	}
+	return nil
+}
+
+// getProviderArn will return the ARN of the OIDC provider of the given issuer URL
+func getProviderArn(identityProviderUrl string, params hce_types.OnboardingParameters) (string, error) {
+
+	// Load session from shared config
+	sess, err := Session(params)
 	if err != nil {
 		return "", err
 	}
+	svc := iam.New(sess)
 
-	conn, err := tls.Dial("tcp", parsedUrl.Host+":443", &tls.Config{
-		InsecureSkipVerify: true,
-	})
+	provider, err := findProvider(svc, identityProviderUrl)
 	if err != nil {
 		return "", err
 	}
-	defer conn.Close()
-
-	cert := conn.ConnectionState().PeerCertificates[0]
-	digest := sha1.Sum(cert.Raw)
-	return strings.ToUpper(hex.EncodeToString(digest[:])), nil
+	if provider == nil {
+		return "", errors.Errorf("no provider found with the given URL: %s", identityProviderUrl)
+	}
+	return provider.ARN, nil
 }
 
-func getProviderArn(identityProviderUrl, region string) (string, error) {
-
-	// Load session from shared config
-	sess := common.GetAWSSession(region)
-	svc := iam.New(sess)
+// findProvider will look up the OIDC provider whose issuer is exactly the given URL, the scheme and trailing slash
+// aside. The details of the providers are fetched in parallel, nil is returned when none matches.
+func findProvider(svc *iam.IAM, providerURL string) (*oidcProvider, error) {
 
-	input := &iam.ListOpenIDConnectProvidersInput{}
-	result, err := svc.ListOpenIDConnectProviders(input)
+	issuer := normalizeIssuer(providerURL)
+	result, err := svc.ListOpenIDConnectProviders(&iam.ListOpenIDConnectProvidersInput{})
 	if err != nil {
-		return "", errors.Errorf("Failed to list providers, err: %v", err)
+		return nil, errors.Errorf("Failed to list providers, err: %v", err)
 	}
 
-	for _, provider := range result.OpenIDConnectProviderList {
-		providerDetails, err := svc.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{
-			OpenIDConnectProviderArn: provider.Arn,
-		})
-		if err != nil {
-			log.Infof("Failed to get provider details for %s, %v", *provider.Arn, err)
-			continue
+	arns := make(chan string)
+	providers := make(chan *oidcProvider)
+	var wg sync.WaitGroup
+	for i := 0; i < providerLookupWorkers && i < len(result.OpenIDConnectProviderList); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for arn := range arns {
+				details, err := svc.GetOpenIDConnectProvider(&iam.GetOpenIDConnectProviderInput{
+					OpenIDConnectProviderArn: aws.String(arn),
+				})
+				if err != nil {
+					log.Infof("Failed to get provider details for %s, %v", arn, err)
+					continue
+				}
+				if normalizeIssuer(aws.StringValue(details.Url)) == issuer {
+					providers <- &oidcProvider{
+						ARN:         arn,
+						Issuer:      issuer,
+						ClientIDs:   aws.StringValueSlice(details.ClientIDList),
+						Thumbprints: aws.StringValueSlice(details.ThumbprintList),
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, provider := range result.OpenIDConnectProviderList {
+			arns <- aws.StringValue(provider.Arn)
 		}
-		if strings.Contains(identityProviderUrl, *providerDetails.Url) {
-			return *provider.Arn, nil
+		close(arns)
+		wg.Wait()
+		close(providers)
+	}()
+
+	// The issuer of a provider is unique in the account, the remaining lookups are drained
+	var found *oidcProvider
+	for provider := range providers {
+		if found == nil {
+			found = provider
 		}
 	}
+	return found, nil
+}
 
-	return "", errors.Errorf("no provider found with the given URL: %s", identityProviderUrl)
+// normalizeIssuer will return the issuer of the provider URL without the scheme and trailing slash, with the host
+// in lower case, as the OIDC providers are stored by IAM
+func normalizeIssuer(providerURL string) string {
+	issuer := strings.TrimSpace(providerURL)
+	if !strings.Contains(issuer, "://") {
+		issuer = "https://" + issuer
+	}
+	parsed, err := url.Parse(issuer)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimSuffix(strings.TrimSpace(providerURL), "/")
+	}
+	return strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.Path, "/")
 }
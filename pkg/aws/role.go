@@ -1,32 +1,43 @@
 package aws
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
 )
 
-// CreateRoleWithTrustRelationsip will create the role or use a existing role with added OIDC provider
-func CreateRoleWithTrustRelationsip(policyARN string, params types.OnboardingParameters) error {
+// CreateRoleWithTrustRelationsip will create the role or use a existing role with added OIDC provider. The
+// inline policies are only put in a new role.
+func CreateRoleWithTrustRelationsip(policyARNs []string, inlinePolicies []Policy, params types.OnboardingParameters) error {
 
 	log.Infof("Provider ARN, %v", params.ProviderARN)
 	// 1. Add provider to a new role with a given role name
 	switch strings.TrimSpace(params.RoleName) {
 	case "":
-		newRoleName := "HCERole-" + params.Infra.Namespace
+		newRoleName, err := ChaosRoleName(params)
+		if err != nil {
+			return err
+		}
 		log.Infof("[Info]: Creating a new role with role name '%v'", newRoleName)
-		if err := addProviderToNewRole(newRoleName, policyARN, params.ProviderARN, params); err != nil {
+		if err := addProviderToNewRole(newRoleName, policyARNs, inlinePolicies, params); err != nil {
 			return err
 		}
 	default:
 		log.Infof("[Info]: Using a existing role with roleARN '%v' for adding provider", params.RoleName)
-		if err := addProviderToExistingRole(params.RoleName, params.ProviderARN, params.Region, params.Infra.Namespace, params.ExperimentServiceAccountName); err != nil {
+		if err := addProviderToExistingRole(params.RoleName, params); err != nil {
+			return err
+		}
+		sess, err := Session(params)
+		if err != nil {
+			return err
+		}
+		if err := AttachManagedPolicies(iam.New(sess), params.RoleName, params); err != nil {
 			return err
 		}
 	}
@@ -34,101 +45,307 @@ func CreateRoleWithTrustRelationsip(policyARN string, params types.OnboardingPar
 	return nil
 }
 
-// addProviderToNewRole will add the OIDC provider to a new role
-func addProviderToNewRole(roleName, policyARN, provider string, params types.OnboardingParameters) error {
+// addProviderToNewRole will add the OIDC provider to a new role, attach the given policies along with the managed
+// policies of the IAM options and put the inline policies. A role created by this cli in an earlier run is adopted,
+// and the chaos policy documents attached to it or put inline in it which are no longer generated are removed.
+func addProviderToNewRole(roleName string, policyARNs []string, inlinePolicies []Policy, params types.OnboardingParameters) error {
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(params.Region),
-	})
+	sess, err := Session(params)
 
 	if err != nil {
 		return err
 	}
 	svc := iam.New(sess)
 
-	_, err = svc.CreateRole(&iam.CreateRoleInput{
-		AssumeRolePolicyDocument: aws.String(fmt.Sprintf(`{
-            "Version": "2012-10-17",
-            "Statement": [
-                {
-                    "Effect": "Allow",
-                    "Principal": {
-                        "Federated": "%s"
-                    },
-                    "Action": "sts:AssumeRoleWithWebIdentity",
-                    "Condition": {
-                        "StringEquals": {
-                            "%s:aud": "system:serviceaccount:%s:%s"
-                        }
-                    }
-                }
-            ]
-        }`, provider, provider, params.Infra.Namespace, params.ExperimentServiceAccountName)),
-		Path:     aws.String("/"),
-		RoleName: aws.String(roleName),
-	})
-
+	trustPolicy, err := TrustPolicyDocument(params)
 	if err != nil {
-		return errors.Errorf("Error creating role: %v", err)
+		return err
+	}
+
+	input := &iam.CreateRoleInput{
+		AssumeRolePolicyDocument: aws.String(trustPolicy),
+		Path:                     aws.String(iamPathPrefix(params.IAM.Path)),
+		RoleName:                 aws.String(roleName),
+		Description:              optionalString(params.IAM.Description),
+		PermissionsBoundary:      optionalString(params.IAM.PermissionsBoundary),
+		Tags:                     resourceTags(params),
+	}
+	if params.IAM.MaxSessionDuration != 0 {
+		input.MaxSessionDuration = aws.Int64(int64(params.IAM.MaxSessionDuration))
+	}
+	if _, err = svc.CreateRole(input); err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != iam.ErrCodeEntityAlreadyExistsException {
+			return iamError("create role '"+roleName+"'", err)
+		}
+		if err := adoptRole(svc, roleName, params); err != nil {
+			return err
+		}
 	}
 
-	// Attach policy to the newly created role
-	_, err = svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
-		PolicyArn: aws.String(policyARN),
-		RoleName:  aws.String(roleName),
-	})
+	// Attach the policies to the newly created role
+	for _, policyARN := range policyARNs {
+		_, err = svc.AttachRolePolicy(&iam.AttachRolePolicyInput{
+			PolicyArn: aws.String(policyARN),
+			RoleName:  aws.String(roleName),
+		})
+
+		if err != nil {
+			return iamError("attach policy '"+policyARN+"'", err)
+		}
+	}
+	for i, policy := range inlinePolicies {
+		policyName, err := PolicyName(params, i)
+		if err != nil {
+			return err
+		}
+		if err := putInlinePolicy(svc, roleName, policyName, policy); err != nil {
+			return err
+		}
+	}
+	if err := AttachManagedPolicies(svc, roleName, params); err != nil {
+		return err
+	}
 
+	// The chaos policy documents of the earlier runs are removed once the current ones are in place, including the
+	// managed documents when the policy is now put inline and the inline documents when it no longer is
+	stale, err := stalePolicyARNs(svc, roleName, policyARNs, params)
 	if err != nil {
-		return errors.Errorf("Error attaching policy, err: %v", err)
+		return err
+	}
+	for _, policyARN := range stale {
+		log.Infof("[Info]: The chaos policy document '%v' is no longer generated, deleting it", policyARN)
+		if err := deletePolicy(svc, policyARN, roleName, params); err != nil {
+			return err
+		}
+	}
+	if !params.IAM.InlinePolicy {
+		policyName, err := PolicyName(params, 0)
+		if err != nil {
+			return err
+		}
+		if err := deleteInlinePolicies(svc, roleName, policyName); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// addProviderToExistingRole will add the OIDC provider to an existing role
-func addProviderToExistingRole(roleName, provider, region, ns, experimentServiceAccount string) error {
-
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	})
+// adoptRole will reuse the chaos role created by this cli in an earlier run, its settings are reconciled with the
+// IAM options and its trust policy is merged with the statement for the experiment service account. The untagged
+// role of an earlier version of this cli is adopted the same way.
+func adoptRole(svc *iam.IAM, roleName string, params types.OnboardingParameters) error {
 
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
 	if err != nil {
+		return errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	if !isManaged(role.Role.Tags) {
+		// The role created by an earlier version of this cli is not tagged, it is adopted when it has its name
+		if !AdoptableRole(roleName, params) {
+			return errors.Errorf("the role '%v' already exists and was not created by this cli, provide it with --role-name to use it", roleName)
+		}
+		log.Infof("[Info]: Adopting the role '%v' created by an earlier version of this cli", roleName)
+	}
+	log.Infof("[Info]: The role '%v' already exists, updating it", roleName)
+	if err := reconcileRole(svc, role.Role, params); err != nil {
 		return err
 	}
-	svc := iam.New(sess)
+	return addProviderToExistingRole(roleName, params)
+}
 
-	_, err = svc.UpdateAssumeRolePolicy(&iam.UpdateAssumeRolePolicyInput{
-		RoleName: aws.String(roleName),
-		PolicyDocument: aws.String(fmt.Sprintf(`{
-            "Version": "2012-10-17",
-            "Statement": [
-                {
-                    "Effect": "Allow",
-                    "Principal": {
-                        "Federated": "%s"
-                    },
-                    "Action": "sts:AssumeRoleWithWebIdentity",
-                    "Condition": {
-                        "StringEquals": {
-                            "%s:aud": "system:serviceaccount:%s:%s"
-                        }
-                    }
-                }
-            ]
-        }`, provider, provider, ns, experimentServiceAccount)),
-	})
+// roleReconcile is the update of the settings of an existing chaos role needed to match the IAM options
+type roleReconcile struct {
+	boundary           string
+	tags               []*iam.Tag
+	description        string
+	maxSessionDuration int64
+	changes            []string
+}
 
+// PlanRoleReconcile will return the changes of the settings of the existing chaos role needed to match the IAM options
+func PlanRoleReconcile(roleName string, params types.OnboardingParameters) ([]string, error) {
+
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	role, err := iam.New(sess).GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
 	if err != nil {
-		return errors.Errorf("Error updating role, err: %v", err)
+		return nil, errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	reconcile, err := planRoleReconcile(role.Role, params)
+	return reconcile.changes, err
+}
+
+// planRoleReconcile will compare the settings of the role with the IAM options, the settings which are not set by
+// the options are kept as they are. The path of a role can't be changed, a different one is an error.
+func planRoleReconcile(role *iam.Role, params types.OnboardingParameters) (roleReconcile, error) {
+
+	var reconcile roleReconcile
+	roleName := aws.StringValue(role.RoleName)
+	if params.IAM.Path != "" && aws.StringValue(role.Path) != params.IAM.Path {
+		return reconcile, errors.Errorf("the role '%v' has the path '%v', not '%v', and the path of a role can't be changed. Use --iam-path %v or delete the role", roleName, aws.StringValue(role.Path), params.IAM.Path, aws.StringValue(role.Path))
+	}
+
+	var boundary string
+	if role.PermissionsBoundary != nil {
+		boundary = aws.StringValue(role.PermissionsBoundary.PermissionsBoundaryArn)
+	}
+	if params.IAM.PermissionsBoundary != "" && boundary != params.IAM.PermissionsBoundary {
+		reconcile.boundary = params.IAM.PermissionsBoundary
+		reconcile.changes = append(reconcile.changes, "permissions boundary: "+orNone(boundary)+" -> "+params.IAM.PermissionsBoundary)
+	}
+
+	current := map[string]string{}
+	for _, tag := range role.Tags {
+		current[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	added := 0
+	for _, tag := range resourceTags(params) {
+		key, value := aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+		old, ok := current[key]
+		if ok && old == value {
+			continue
+		}
+		if !ok {
+			added++
+			old = "none"
+		}
+		reconcile.tags = append(reconcile.tags, tag)
+		reconcile.changes = append(reconcile.changes, "tag "+key+": "+old+" -> "+value)
+	}
+	if len(current)+added > maxTags {
+		return reconcile, errors.Errorf("the role '%v' has %v tags, adding %v more exceeds the limit of %v tags of a role", roleName, len(current), added, maxTags)
+	}
+
+	if params.IAM.Description != "" && aws.StringValue(role.Description) != params.IAM.Description {
+		reconcile.description = params.IAM.Description
+		reconcile.changes = append(reconcile.changes, "description: "+orNone(aws.StringValue(role.Description))+" -> "+params.IAM.Description)
+	}
+	if duration := int64(params.IAM.MaxSessionDuration); duration != 0 && aws.Int64Value(role.MaxSessionDuration) != duration {
+		reconcile.maxSessionDuration = duration
+		reconcile.changes = append(reconcile.changes, "max session duration: "+strconv.FormatInt(aws.Int64Value(role.MaxSessionDuration), 10)+" -> "+strconv.FormatInt(duration, 10))
+	}
+	return reconcile, nil
+}
+
+// reconcileRole will update the permissions boundary, tags, description and max session duration of the role to
+// match the IAM options
+func reconcileRole(svc *iam.IAM, role *iam.Role, params types.OnboardingParameters) error {
+
+	reconcile, err := planRoleReconcile(role, params)
+	if err != nil {
+		return err
+	}
+	roleName := aws.StringValue(role.RoleName)
+	if reconcile.boundary != "" {
+		if _, err := svc.PutRolePermissionsBoundary(&iam.PutRolePermissionsBoundaryInput{
+			RoleName:            aws.String(roleName),
+			PermissionsBoundary: aws.String(reconcile.boundary),
+		}); err != nil {
+			return iamError("set the permissions boundary of role '"+roleName+"'", err)
+		}
+	}
+	if len(reconcile.tags) != 0 {
+		if _, err := svc.TagRole(&iam.TagRoleInput{RoleName: aws.String(roleName), Tags: reconcile.tags}); err != nil {
+			return iamError("tag role '"+roleName+"'", err)
+		}
+	}
+	if reconcile.description != "" {
+		if _, err := svc.UpdateRoleDescription(&iam.UpdateRoleDescriptionInput{
+			RoleName:    aws.String(roleName),
+			Description: aws.String(reconcile.description),
+		}); err != nil {
+			return iamError("update the description of role '"+roleName+"'", err)
+		}
+	}
+	if reconcile.maxSessionDuration != 0 {
+		if _, err := svc.UpdateRole(&iam.UpdateRoleInput{
+			RoleName:           aws.String(roleName),
+			MaxSessionDuration: aws.Int64(reconcile.maxSessionDuration),
+		}); err != nil {
+			return iamError("update the max session duration of role '"+roleName+"'", err)
+		}
+	}
+	for _, change := range reconcile.changes {
+		log.Infof("[Info]: Updated the role '%v', %v", roleName, change)
 	}
 	return nil
 }
 
+// orNone will return the value, or none when it is empty
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// StalePolicyARNs will return the chaos policy documents attached to the role which are not among the given ones,
+// like the documents split off the chaos policy when it needed more of them. The role doesn't have to exist yet.
+func StalePolicyARNs(roleName string, policyARNs []string, params types.OnboardingParameters) ([]string, error) {
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	return stalePolicyARNs(iam.New(sess), roleName, policyARNs, params)
+}
+
+// stalePolicyARNs will compare the chaos policy documents attached to the role with the given ones
+func stalePolicyARNs(svc *iam.IAM, roleName string, policyARNs []string, params types.OnboardingParameters) ([]string, error) {
+
+	policyName, err := PolicyName(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	documents := map[string]bool{}
+	for i := 0; i < maxAttachedPolicies; i++ {
+		documents[documentName(policyName, i)] = true
+	}
+	current := map[string]bool{}
+	for _, policyARN := range policyARNs {
+		current[policyARN] = true
+	}
+
+	var stale []string
+	err = svc.ListAttachedRolePoliciesPages(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)},
+		func(page *iam.ListAttachedRolePoliciesOutput, lastPage bool) bool {
+			for _, policy := range page.AttachedPolicies {
+				if documents[aws.StringValue(policy.PolicyName)] && !current[aws.StringValue(policy.PolicyArn)] {
+					stale = append(stale, aws.StringValue(policy.PolicyArn))
+				}
+			}
+			return true
+		})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Errorf("failed to list the policies attached to role '%v', err: %v", roleName, err)
+	}
+	return stale, nil
+}
+
+// addProviderToExistingRole will add the OIDC provider to the trust policy of an existing role, keeping its other statements
+func addProviderToExistingRole(roleName string, params types.OnboardingParameters) error {
+
+	update, err := PlanTrustUpdate(roleName, params)
+	if err != nil {
+		return err
+	}
+	if !update.Changed {
+		log.Infof("[Info]: The role '%v' already trusts the service accounts, skipping the update", roleName)
+		return nil
+	}
+	log.Infof("[Info]: Updating the trust policy of role '%v':\n%v", roleName, update.Diff)
+
+	return ApplyTrustUpdate(update, params)
+}
+
 // GetRoleARN will return the roleARN for given roleName
-func GetRoleARN(region, roleName string) (string, error) {
+func GetRoleARN(params types.OnboardingParameters, roleName string) (string, error) {
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	})
+	sess, err := Session(params)
 
 	if err != nil {
 		return "", err
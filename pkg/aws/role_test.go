@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+func TestPlanRoleReconcile(t *testing.T) {
+
+	boundary := "arn:aws:iam::123456789012:policy/boundary"
+	params := testNamingParams("hce", "", "")
+	managed := func(extra ...*iam.Tag) []*iam.Tag {
+		return append(managedTags("hce"), extra...)
+	}
+	var manyTags []*iam.Tag
+	for i := 0; i < maxTags-len(managedTags("hce")); i++ {
+		manyTags = append(manyTags, &iam.Tag{Key: aws.String("key-" + strings.Repeat("k", i)), Value: aws.String("value")})
+	}
+
+	tests := []struct {
+		name    string
+		role    iam.Role
+		iam     types.IAMOptions
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "role matching the options",
+			role: iam.Role{RoleName: aws.String("HCERole-hce"), Path: aws.String("/"), Tags: managed()},
+			iam:  types.IAMOptions{Path: "/"},
+		},
+		{
+			name: "settings not set by the options are kept",
+			role: iam.Role{
+				RoleName:            aws.String("HCERole-hce"),
+				Path:                aws.String("/chaos/"),
+				Description:         aws.String("set by hand"),
+				MaxSessionDuration:  aws.Int64(7200),
+				PermissionsBoundary: &iam.AttachedPermissionsBoundary{PermissionsBoundaryArn: aws.String(boundary)},
+				Tags:                managed(&iam.Tag{Key: aws.String("owner"), Value: aws.String("sre")}),
+			},
+		},
+		{
+			name: "every setting differs",
+			role: iam.Role{
+				RoleName:           aws.String("HCERole-hce"),
+				Path:               aws.String("/"),
+				Description:        aws.String("old"),
+				MaxSessionDuration: aws.Int64(3600),
+				Tags:               managed(&iam.Tag{Key: aws.String("team"), Value: aws.String("qa")}),
+			},
+			iam: types.IAMOptions{PermissionsBoundary: boundary, Tags: "team=sre,cost=chaos", Description: "new", MaxSessionDuration: 7200},
+			want: []string{
+				"permissions boundary: none -> " + boundary,
+				"tag cost: none -> chaos",
+				"tag team: qa -> sre",
+				"description: old -> new",
+				"max session duration: 3600 -> 7200",
+			},
+		},
+		{
+			name: "untagged role of an earlier version gets the managed tags",
+			role: iam.Role{RoleName: aws.String("HCERole-hce"), Path: aws.String("/")},
+			want: []string{
+				"tag " + types.ManagedByKey + ": none -> " + types.ManagedByValue,
+				"tag " + namespaceTagKey + ": none -> hce",
+			},
+		},
+		{
+			name:    "path can't be changed",
+			role:    iam.Role{RoleName: aws.String("HCERole-hce"), Path: aws.String("/"), Tags: managed()},
+			iam:     types.IAMOptions{Path: "/chaos/"},
+			wantErr: "the role 'HCERole-hce' has the path '/', not '/chaos/'",
+		},
+		{
+			name:    "tags over the limit of the role",
+			role:    iam.Role{RoleName: aws.String("HCERole-hce"), Path: aws.String("/"), Tags: managed(manyTags...)},
+			iam:     types.IAMOptions{Tags: "team=sre"},
+			wantErr: "has 50 tags, adding 1 more exceeds the limit of 50 tags of a role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params.IAM = tt.iam
+			reconcile, err := planRoleReconcile(&tt.role, params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("planRoleReconcile() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planRoleReconcile() unexpected err: %v", err)
+			}
+			if !reflect.DeepEqual(reconcile.changes, tt.want) {
+				t.Errorf("planRoleReconcile() changes = %q, want %q", reconcile.changes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package aws
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// The condition keys the mutating actions can be scoped with
+const (
+	conditionResourceTag     = "aws:ResourceTag"
+	conditionRequestedRegion = "aws:RequestedRegion"
+	conditionVpc             = "ec2:Vpc"
+	conditionPolicyARN       = "iam:PolicyARN"
+)
+
+// scopeConditionKeys are the condition keys accepted in the scoping of the policy catalog
+var scopeConditionKeys = map[string]bool{
+	conditionResourceTag:     true,
+	conditionRequestedRegion: true,
+	conditionVpc:             true,
+	conditionPolicyARN:       true,
+}
+
+var (
+	regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	vpcPattern    = regexp.MustCompile(`^vpc-[0-9a-f]+$`)
+	tagKeyPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{1,128}$`)
+)
+
+// policyScope is the parsed scope of the chaos policy
+type policyScope struct {
+	tags    map[string]string
+	arns    []string
+	regions []string
+	vpcs    []string
+}
+
+// parseScope will split and validate the comma separated lists of the policy scope
+func parseScope(scope types.PolicyScope) (policyScope, error) {
+
+	var parsed policyScope
+	tags, err := parseTags(scope.Tags)
+	if err != nil {
+		return parsed, errors.Errorf("invalid scope, %v", err)
+	}
+	parsed.tags = tags
+	for _, arn := range splitNames(scope.ResourceARNs) {
+		if len(strings.Split(arn, ":")) < 6 || !strings.HasPrefix(arn, "arn:") {
+			return parsed, errors.Errorf("invalid scope resource ARN '%v', expected arn:<partition>:<service>:<region>:<account>:<resource>", arn)
+		}
+		parsed.arns = append(parsed.arns, arn)
+	}
+	for _, region := range splitNames(scope.Regions) {
+		if !regionPattern.MatchString(region) {
+			return parsed, errors.Errorf("invalid scope region '%v'", region)
+		}
+		parsed.regions = append(parsed.regions, region)
+	}
+	for _, vpc := range splitNames(scope.VPCs) {
+		if !vpcPattern.MatchString(vpc) {
+			return parsed, errors.Errorf("invalid scope VPC '%v', expected a VPC ID like vpc-0123456789abcdef0", vpc)
+		}
+		parsed.vpcs = append(parsed.vpcs, "arn:*:ec2:*:*:vpc/"+vpc)
+	}
+	return parsed, nil
+}
+
+// empty will check if nothing restricts the policy
+func (s policyScope) empty() bool {
+	return len(s.tags) == 0 && len(s.arns) == 0 && len(s.regions) == 0 && len(s.vpcs) == 0
+}
+
+// ScopePolicy will restrict the mutating actions of the policy to the resources of the scope: the resource ARNs
+// of their service, and the tags, regions and VPCs through the condition keys each action supports. The Describe,
+// List and Get actions are left unrestricted. The actions which can't be restricted as requested are logged.
+func (r *Registry) ScopePolicy(policy Policy, scope types.PolicyScope) (Policy, error) {
+
+	parsed, err := parseScope(scope)
+	if err != nil {
+		return Policy{}, err
+	}
+	if parsed.empty() {
+		return policy, nil
+	}
+
+	unscoped := map[string][]string{}
+	scoped := Policy{Version: policy.Version}
+	for _, stmt := range policy.Statement {
+		if stmt.Effect != "Allow" {
+			scoped.Statement = append(scoped.Statement, stmt)
+			continue
+		}
+
+		// Group the actions of the statement by their scoped resources and conditions
+		var keys []string
+		grouped := map[string]*Statement{}
+		for _, action := range stmt.Action {
+			actionStmt := r.scopeAction(stmt, action, parsed, unscoped)
+			key := statementKey(actionStmt)
+			if grouped[key] == nil {
+				keys = append(keys, key)
+				grouped[key] = &actionStmt
+			}
+			grouped[key].Action = append(grouped[key].Action, action)
+		}
+		for _, key := range keys {
+			scoped.Statement = append(scoped.Statement, *grouped[key])
+		}
+	}
+
+	for _, restriction := range sortedKeys(unscoped) {
+		log.Warnf("[Warning]: The actions %v can't be restricted by %v and are granted on any resource", strings.Join(subtract(unscoped[restriction], nil), ", "), restriction)
+	}
+	return scoped, nil
+}
+
+// scopeAction will return the statement granting the action within the scope, the restrictions the action
+// doesn't support are recorded in unscoped
+func (r *Registry) scopeAction(stmt Statement, action string, scope policyScope, unscoped map[string][]string) Statement {
+
+	scoped := Statement{Effect: stmt.Effect, Resource: stmt.Resource, Condition: copyConditions(stmt.Condition)}
+	if isReadOnly(action) {
+		return scoped
+	}
+
+	scoping := r.scoping[action]
+	supported := map[string]bool{}
+	for _, key := range scoping.ConditionKeys {
+		supported[key] = true
+	}
+	if len(scope.arns) != 0 {
+		restricted := false
+		if resources := scopeResources(scoping.ResourceTypes, scope.arns); len(resources) != 0 {
+			scoped.Resource = resources
+			restricted = true
+		}
+		// The resource of the actions attaching a policy is the role, the policy is restricted through a condition
+		if policies := arnsOfType(scope.arns, "iam:policy"); supported[conditionPolicyARN] && len(policies) != 0 {
+			addCondition(&scoped, "ArnEquals", conditionPolicyARN, policies)
+			restricted = true
+		}
+		if !restricted {
+			unscoped["resource ARN"] = append(unscoped["resource ARN"], action)
+		}
+	}
+	if len(scope.regions) != 0 {
+		if supported[conditionRequestedRegion] {
+			addCondition(&scoped, "StringEquals", conditionRequestedRegion, scope.regions)
+		} else {
+			unscoped["region"] = append(unscoped["region"], action)
+		}
+	}
+	if len(scope.tags) != 0 {
+		if supported[conditionResourceTag] {
+			for _, key := range sortedKeys(scope.tags) {
+				addCondition(&scoped, "StringEquals", conditionResourceTag+"/"+key, scope.tags[key])
+			}
+		} else {
+			unscoped["tag"] = append(unscoped["tag"], action)
+		}
+	}
+	if len(scope.vpcs) != 0 {
+		if supported[conditionVpc] {
+			addCondition(&scoped, "ArnLike", conditionVpc, scope.vpcs)
+		} else {
+			unscoped["VPC"] = append(unscoped["VPC"], action)
+		}
+	}
+	return scoped
+}
+
+// scopeResources will return the resources of an action from the ARNs of the scope matching its resource types. The
+// resource types without any ARN are kept unrestricted, nothing is returned when none of them has an ARN.
+func scopeResources(resourceTypes, arns []string) []string {
+	var resources, unrestricted []string
+	for _, resourceType := range resourceTypes {
+		matched := false
+		for _, arn := range arns {
+			if arnResourceType(arn) == resourceType {
+				resources = append(resources, arn)
+				matched = true
+			}
+		}
+		if !matched {
+			parts := strings.SplitN(resourceType, ":", 2)
+			unrestricted = append(unrestricted, "arn:*:"+parts[0]+":*:*:"+parts[1]+"*")
+		}
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+	return append(resources, unrestricted...)
+}
+
+// arnsOfType will return the ARNs of the given resource type
+func arnsOfType(arns []string, resourceType string) []string {
+	var result []string
+	for _, arn := range arns {
+		if arnResourceType(arn) == resourceType {
+			result = append(result, arn)
+		}
+	}
+	return result
+}
+
+// arnResourceType will return the <service>:<resource-type> of the ARN, the resource type is the part of the
+// resource before the first '/' or ':'
+func arnResourceType(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	resource := parts[5]
+	if index := strings.IndexAny(resource, "/:"); index != -1 {
+		resource = resource[:index]
+	}
+	return parts[2] + ":" + resource
+}
+
+// isReadOnly will check if the action only reads resources, these actions are never restricted by the scope
+func isReadOnly(action string) bool {
+	name := action[strings.Index(action, ":")+1:]
+	for _, prefix := range []string{"Describe", "List", "Get"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addCondition will add the condition to the statement
+func addCondition(stmt *Statement, operator, key string, value interface{}) {
+	if stmt.Condition == nil {
+		stmt.Condition = map[string]map[string]interface{}{}
+	}
+	if stmt.Condition[operator] == nil {
+		stmt.Condition[operator] = map[string]interface{}{}
+	}
+	stmt.Condition[operator][key] = value
+}
+
+// copyConditions will copy the conditions so they can be extended for a single action
+func copyConditions(conditions map[string]map[string]interface{}) map[string]map[string]interface{} {
+	if conditions == nil {
+		return nil
+	}
+	copied := map[string]map[string]interface{}{}
+	for operator, values := range conditions {
+		copied[operator] = map[string]interface{}{}
+		for key, value := range values {
+			copied[operator][key] = value
+		}
+	}
+	return copied
+}
@@ -0,0 +1,197 @@
+package aws
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+const (
+	testInstanceARN = "arn:aws:ec2:us-east-1:123456789012:instance/i-0123456789abcdef0"
+	testPolicyARN   = "arn:aws:iam::123456789012:policy/chaos-extra"
+)
+
+// testAllow will return an allow statement of the actions on every resource
+func testAllow(actions ...string) Statement {
+	return Statement{Effect: "Allow", Action: actions, Resource: []string{"*"}}
+}
+
+// testCondition will return the single condition of the operator and key
+func testCondition(operator, key string, value interface{}) map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{operator: {key: value}}
+}
+
+func TestScopePolicy(t *testing.T) {
+
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected err: %v", err)
+	}
+	deny := Statement{Effect: "Deny", Action: []string{"ec2:StopInstances"}, Resource: []string{testInstanceARN}}
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		scope   types.PolicyScope
+		want    []Statement
+		wantErr string
+	}{
+		{
+			name:   "empty scope leaves the policy as is",
+			policy: testPolicy(testAllow("ec2:StartInstances")),
+			want:   []Statement{testAllow("ec2:StartInstances")},
+		},
+		{
+			name:   "tag scope restricts the mutating actions only",
+			policy: testPolicy(testAllow("ec2:DescribeInstances", "ec2:StartInstances", "ec2:StopInstances")),
+			scope:  types.PolicyScope{Tags: "env=chaos"},
+			want: []Statement{
+				testAllow("ec2:DescribeInstances"),
+				{Effect: "Allow", Action: []string{"ec2:StartInstances", "ec2:StopInstances"}, Resource: []string{"*"}, Condition: testCondition("StringEquals", "aws:ResourceTag/env", "chaos")},
+			},
+		},
+		{
+			name:   "region scope on an action without the tag condition",
+			policy: testPolicy(testAllow("ec2:CreateNetworkAcl")),
+			scope:  types.PolicyScope{Regions: "us-east-1"},
+			want: []Statement{
+				{Effect: "Allow", Action: []string{"ec2:CreateNetworkAcl"}, Resource: []string{"*"}, Condition: testCondition("StringEquals", "aws:RequestedRegion", []string{"us-east-1"})},
+			},
+		},
+		{
+			name:   "resource ARNs replace the resources of their type",
+			policy: testPolicy(testAllow("ec2:StartInstances", "ec2:AttachVolume")),
+			scope:  types.PolicyScope{ResourceARNs: testInstanceARN},
+			want: []Statement{
+				{Effect: "Allow", Action: []string{"ec2:StartInstances"}, Resource: []string{testInstanceARN}},
+				{Effect: "Allow", Action: []string{"ec2:AttachVolume"}, Resource: []string{testInstanceARN, "arn:*:ec2:*:*:volume*"}},
+			},
+		},
+		{
+			name:   "policy ARNs restrict the attached policies through a condition",
+			policy: testPolicy(testAllow("iam:AttachRolePolicy", "iam:PassRole")),
+			scope:  types.PolicyScope{ResourceARNs: testPolicyARN},
+			want: []Statement{
+				{Effect: "Allow", Action: []string{"iam:AttachRolePolicy"}, Resource: []string{"*"}, Condition: testCondition("ArnEquals", "iam:PolicyARN", []string{testPolicyARN})},
+				testAllow("iam:PassRole"),
+			},
+		},
+		{
+			name:   "VPC scope",
+			policy: testPolicy(testAllow("ec2:AuthorizeSecurityGroupIngress")),
+			scope:  types.PolicyScope{VPCs: "vpc-0abc"},
+			want: []Statement{
+				{Effect: "Allow", Action: []string{"ec2:AuthorizeSecurityGroupIngress"}, Resource: []string{"*"}, Condition: testCondition("ArnLike", "ec2:Vpc", []string{"arn:*:ec2:*:*:vpc/vpc-0abc"})},
+			},
+		},
+		{
+			name:   "deny statements are kept as is",
+			policy: testPolicy(deny),
+			scope:  types.PolicyScope{Tags: "env=chaos"},
+			want:   []Statement{deny},
+		},
+		{
+			name:    "invalid region",
+			policy:  testPolicy(testAllow("ec2:StartInstances")),
+			scope:   types.PolicyScope{Regions: "east"},
+			wantErr: "invalid scope region 'east'",
+		},
+		{
+			name:    "invalid resource ARN",
+			policy:  testPolicy(testAllow("ec2:StartInstances")),
+			scope:   types.PolicyScope{ResourceARNs: "i-0123456789abcdef0"},
+			wantErr: "invalid scope resource ARN",
+		},
+		{
+			name:    "invalid VPC",
+			policy:  testPolicy(testAllow("ec2:StartInstances")),
+			scope:   types.PolicyScope{VPCs: "0abc"},
+			wantErr: "invalid scope VPC '0abc'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped, err := registry.ScopePolicy(tt.policy, tt.scope)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ScopePolicy() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ScopePolicy() unexpected err: %v", err)
+			}
+			if !reflect.DeepEqual(scoped.Statement, tt.want) {
+				t.Errorf("ScopePolicy() = %+v, want %+v", scoped.Statement, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeActionUnscoped(t *testing.T) {
+
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry() unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		action string
+		scope  types.PolicyScope
+		want   map[string][]string
+	}{
+		{
+			name:   "supported restrictions are not reported",
+			action: "ec2:StartInstances",
+			scope:  types.PolicyScope{Tags: "env=chaos", Regions: "us-east-1", ResourceARNs: testInstanceARN},
+			want:   map[string][]string{},
+		},
+		{
+			name:   "read only actions are never reported",
+			action: "ec2:DescribeInstances",
+			scope:  types.PolicyScope{Tags: "env=chaos", VPCs: "vpc-0abc"},
+			want:   map[string][]string{},
+		},
+		{
+			name:   "unsupported condition keys are reported",
+			action: "ec2:CreateNetworkAcl",
+			scope:  types.PolicyScope{Tags: "env=chaos", Regions: "us-east-1", VPCs: "vpc-0abc"},
+			want:   map[string][]string{"tag": {"ec2:CreateNetworkAcl"}, "VPC": {"ec2:CreateNetworkAcl"}},
+		},
+		{
+			name:   "resource ARNs of another type are reported",
+			action: "ec2:StartInstances",
+			scope:  types.PolicyScope{ResourceARNs: testPolicyARN},
+			want:   map[string][]string{"resource ARN": {"ec2:StartInstances"}},
+		},
+		{
+			name:   "action without scoping is reported for every restriction",
+			action: "fis:InjectApiInternalError",
+			scope:  types.PolicyScope{Tags: "env=chaos", Regions: "us-east-1", ResourceARNs: testInstanceARN, VPCs: "vpc-0abc"},
+			want: map[string][]string{
+				"tag":          {"fis:InjectApiInternalError"},
+				"region":       {"fis:InjectApiInternalError"},
+				"resource ARN": {"fis:InjectApiInternalError"},
+				"VPC":          {"fis:InjectApiInternalError"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseScope(tt.scope)
+			if err != nil {
+				t.Fatalf("parseScope() unexpected err: %v", err)
+			}
+			unscoped := map[string][]string{}
+			registry.scopeAction(testAllow(tt.action), tt.action, parsed, unscoped)
+			if !reflect.DeepEqual(unscoped, tt.want) {
+				t.Errorf("scopeAction() unscoped = %v, want %v", unscoped, tt.want)
+			}
+		})
+	}
+}
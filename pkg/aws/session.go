@@ -0,0 +1,32 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// NewSession will return the aws session of the profile and credentials file in the region. They are passed to the
+// session rather than exported, so the onboardings of several infras can use different credentials at once.
+func NewSession(region, profile, credentialFile string) (*session.Session, error) {
+	options := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config:            aws.Config{Region: aws.String(region)},
+		Profile:           profile,
+	}
+	if credentialFile != "" {
+		options.SharedConfigFiles = []string{credentialFile, defaults.SharedConfigFilename()}
+	}
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, errors.Errorf("failed to create the aws session of profile '%v', err: %v", profile, err)
+	}
+	return sess, nil
+}
+
+// Session will return the aws session of the profile and credentials file of the params
+func Session(params types.OnboardingParameters) (*session.Session, error) {
+	return NewSession(params.Region, params.AWSProfile, params.AWSCredentialFile)
+}
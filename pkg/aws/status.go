@@ -0,0 +1,203 @@
+package aws
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// RoleStatus is the health of the chaos role as seen from the experiment service account
+type RoleStatus struct {
+	RoleName             string   `json:"roleName"`
+	Exists               bool     `json:"exists"`
+	ProviderARN          string   `json:"providerARN,omitempty"`
+	TrustsProvider       bool     `json:"trustsProvider"`
+	TrustsServiceAccount bool     `json:"trustsServiceAccount"`
+	TrustIssues          []string `json:"trustIssues,omitempty"`
+	MissingActions       []string `json:"missingActions,omitempty"`
+}
+
+// InspectRole will check if the given role exists, trusts the OIDC provider of the cluster for the
+// experiment service account and grants every action needed by the given resource groups
+func InspectRole(roleName string, params types.OnboardingParameters) (RoleStatus, error) {
+
+	status := RoleStatus{RoleName: roleName}
+
+	sess, err := Session(params)
+	if err != nil {
+		return RoleStatus{}, err
+	}
+	svc := iam.New(sess)
+
+	if _, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)}); err != nil {
+		if isNotFound(err) {
+			return status, nil
+		}
+		return status, errors.Errorf("failed to get role '%v', err: %v", roleName, err)
+	}
+	status.Exists = true
+
+	// The trust can't be verified without the OIDC provider, which is reported as an issue of the trust
+	trust, err := VerifyRoleTrust(roleName, params)
+	if err != nil {
+		status.TrustIssues = []string{err.Error()}
+	} else {
+		status.ProviderARN = trust.ProviderARN
+		status.TrustsProvider = trust.TrustsProvider
+		status.TrustsServiceAccount = trust.CanAssume
+		status.TrustIssues = trust.Reasons
+	}
+
+	granted, err := roleActions(svc, roleName)
+	if err != nil {
+		return status, err
+	}
+	registry, err := NewRegistry(params.PolicyCatalog)
+	if err != nil {
+		return status, err
+	}
+	required, err := registry.Build(params.Resources, params.Faults)
+	if err != nil {
+		return status, err
+	}
+	status.MissingActions = missingActions(granted, required)
+	return status, nil
+}
+
+// roleActions will return the actions allowed by the managed and inline policies of the role
+func roleActions(svc *iam.IAM, roleName string) ([]string, error) {
+
+	var documents []string
+
+	attached, err := svc.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, errors.Errorf("failed to list the policies attached to role '%v', err: %v", roleName, err)
+	}
+	for _, attachedPolicy := range attached.AttachedPolicies {
+		policy, err := svc.GetPolicy(&iam.GetPolicyInput{PolicyArn: attachedPolicy.PolicyArn})
+		if err != nil {
+			return nil, errors.Errorf("failed to get policy '%v', err: %v", aws.StringValue(attachedPolicy.PolicyArn), err)
+		}
+		version, err := svc.GetPolicyVersion(&iam.GetPolicyVersionInput{
+			PolicyArn: attachedPolicy.PolicyArn,
+			VersionId: policy.Policy.DefaultVersionId,
+		})
+		if err != nil {
+			return nil, errors.Errorf("failed to get the default version of policy '%v', err: %v", aws.StringValue(attachedPolicy.PolicyArn), err)
+		}
+		documents = append(documents, aws.StringValue(version.PolicyVersion.Document))
+	}
+
+	inline, err := svc.ListRolePolicies(&iam.ListRolePoliciesInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, errors.Errorf("failed to list the inline policies of role '%v', err: %v", roleName, err)
+	}
+	for _, policyName := range inline.PolicyNames {
+		policy, err := svc.GetRolePolicy(&iam.GetRolePolicyInput{RoleName: aws.String(roleName), PolicyName: policyName})
+		if err != nil {
+			return nil, errors.Errorf("failed to get the inline policy '%v', err: %v", aws.StringValue(policyName), err)
+		}
+		documents = append(documents, aws.StringValue(policy.PolicyDocument))
+	}
+
+	var actions []string
+	for _, document := range documents {
+		decoded, err := url.QueryUnescape(document)
+		if err != nil {
+			return nil, errors.Errorf("failed to decode policy document, err: %v", err)
+		}
+		allowed, err := allowedActions(decoded)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, allowed...)
+	}
+	return actions, nil
+}
+
+// documentStatement is a statement of a policy document read from IAM
+type documentStatement struct {
+	Effect string
+	Action json.RawMessage
+}
+
+// allowedActions will return the actions of the Allow statements of the given policy document
+func allowedActions(document string) ([]string, error) {
+
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, errors.Errorf("failed to parse policy document, err: %v", err)
+	}
+
+	// The Statement can either be a single statement or a list of statements
+	var statements []documentStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var statement documentStatement
+		if err := json.Unmarshal(policy.Statement, &statement); err != nil {
+			return nil, errors.Errorf("failed to parse policy statement, err: %v", err)
+		}
+		statements = []documentStatement{statement}
+	}
+
+	var actions []string
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || len(statement.Action) == 0 {
+			continue
+		}
+		list, err := stringOrSlice(statement.Action)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, list...)
+	}
+	return actions, nil
+}
+
+// stringOrSlice will decode a policy element which can either be a string or a list of strings
+func stringOrSlice(raw json.RawMessage) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err != nil {
+		return nil, errors.Errorf("failed to parse policy element, err: %v", err)
+	}
+	return []string{single}, nil
+}
+
+// missingActions will return the actions of the required policy which are not granted, wildcards are honoured
+func missingActions(granted []string, required Policy) []string {
+	var missing []string
+	for _, statement := range required.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, action := range statement.Action {
+			if !actionGranted(granted, action) {
+				missing = append(missing, action)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// actionGranted will check if the action matches any of the granted actions, IAM actions are case insensitive
+func actionGranted(granted []string, action string) bool {
+	for _, pattern := range granted {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(action)); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// discoveryTimeout is the timeout of the requests to the OIDC issuer
+const discoveryTimeout = 10 * time.Second
+
+var thumbprintPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// openIDConfiguration is the part of the OIDC discovery document needed for the thumbprint
+type openIDConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JwksURI string `json:"jwks_uri"`
+}
+
+// getThumbprint will return the thumbprint of the OIDC provider, either provided in the params or computed as IAM
+// expects it: the SHA-1 of the last certificate in the verified chain served by the host of the jwks_uri of the
+// issuer. The chain is verified against the system roots and the CA bundle of the params.
+func getThumbprint(params types.OnboardingParameters) (string, error) {
+
+	if params.Thumbprint != "" {
+		if !thumbprintPattern.MatchString(params.Thumbprint) {
+			return "", errors.Errorf("invalid thumbprint '%v', expected the 40 hex characters of a SHA-1 fingerprint", params.Thumbprint)
+		}
+		return strings.ToUpper(params.Thumbprint), nil
+	}
+
+	roots, err := rootCAs(params.CABundle)
+	if err != nil {
+		return "", err
+	}
+	tlsConfig := &tls.Config{RootCAs: roots}
+
+	configuration, err := discoverIssuer(params.ProviderUrl, tlsConfig)
+	if err != nil {
+		return "", err
+	}
+	jwksURL, err := url.Parse(configuration.JwksURI)
+	if err != nil || jwksURL.Hostname() == "" {
+		return "", errors.Errorf("invalid jwks_uri '%v' of the issuer '%v'", configuration.JwksURI, params.ProviderUrl)
+	}
+	port := jwksURL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &net.Dialer{Timeout: discoveryTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(jwksURL.Hostname(), port), &tls.Config{
+		RootCAs:    roots,
+		ServerName: jwksURL.Hostname(),
+	})
+	if err != nil {
+		return "", errors.Errorf("failed to verify the TLS certificate of the jwks_uri host '%v', err: %v", jwksURL.Host, err)
+	}
+	defer conn.Close()
+
+	// The certificates are verified by the handshake, the last one served is the top CA of the chain
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return "", errors.Errorf("no TLS certificate served by the jwks_uri host '%v'", jwksURL.Host)
+	}
+	digest := sha1.Sum(certificates[len(certificates)-1].Raw)
+	return strings.ToUpper(hex.EncodeToString(digest[:])), nil
+}
+
+// discoverIssuer will fetch the OIDC discovery document of the issuer, over a verified TLS connection, and check
+// that it is issued for the issuer
+func discoverIssuer(providerURL string, tlsConfig *tls.Config) (openIDConfiguration, error) {
+
+	issuer, err := url.Parse(strings.TrimSpace(providerURL))
+	if err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		return openIDConfiguration{}, errors.Errorf("invalid provider URL '%v', expected https://<issuer>", providerURL)
+	}
+	discoveryURL := strings.TrimSuffix(issuer.String(), "/") + "/.well-known/openid-configuration"
+
+	client := &http.Client{
+		Timeout:   discoveryTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+	resp, err := client.Get(discoveryURL)
+	if err != nil {
+		return openIDConfiguration{}, errors.Errorf("failed to fetch the OIDC discovery document '%v', err: %v", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return openIDConfiguration{}, errors.Errorf("failed to fetch the OIDC discovery document '%v', status: %v", discoveryURL, resp.Status)
+	}
+
+	var configuration openIDConfiguration
+	if err := json.NewDecoder(resp.Body).Decode(&configuration); err != nil {
+		return openIDConfiguration{}, errors.Errorf("failed to parse the OIDC discovery document '%v', err: %v", discoveryURL, err)
+	}
+	if normalizeIssuer(configuration.Issuer) != normalizeIssuer(providerURL) {
+		return openIDConfiguration{}, errors.Errorf("the OIDC discovery document of '%v' is issued for '%v'", providerURL, configuration.Issuer)
+	}
+	if configuration.JwksURI == "" {
+		return openIDConfiguration{}, errors.Errorf("the OIDC discovery document '%v' has no jwks_uri", discoveryURL)
+	}
+	return configuration, nil
+}
+
+// rootCAs will return the system roots along with the certificates of the CA bundle file
+func rootCAs(caBundle string) (*x509.CertPool, error) {
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if caBundle == "" {
+		return roots, nil
+	}
+	data, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, errors.Errorf("failed to read CA bundle '%v', err: %v", caBundle, err)
+	}
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("no PEM certificate found in CA bundle '%v'", caBundle)
+	}
+	return roots, nil
+}
@@ -0,0 +1,434 @@
+package aws
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+const (
+	// webIdentityAction is the action used by the pods to assume the role with their service account token
+	webIdentityAction = "sts:AssumeRoleWithWebIdentity"
+	// stsAudience is the audience of the service account tokens projected by EKS
+	stsAudience = "sts.amazonaws.com"
+)
+
+// TrustPolicy is the trust policy document of a role
+type TrustPolicy struct {
+	Version   string
+	Statement []TrustStatement
+}
+
+// TrustStatement is a statement of a trust policy
+type TrustStatement struct {
+	Sid       string `json:",omitempty"`
+	Effect    string
+	Principal TrustPrincipal
+	Action    string
+	Condition map[string]map[string]interface{} `json:",omitempty"`
+}
+
+// TrustPrincipal is the principal allowed to assume the role
+type TrustPrincipal struct {
+	Federated string
+}
+
+// IssuerHost will return the issuer of the OIDC provider without the scheme, as used in the condition keys.
+// It is derived from the provider URL, or from the provider ARN when the URL is not known.
+func IssuerHost(providerURL, providerARN string) string {
+	if providerURL != "" {
+		if parsed, err := url.Parse(providerURL); err == nil && parsed.Host != "" {
+			return strings.TrimSuffix(parsed.Host+parsed.Path, "/")
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(providerURL, "https://"), "/")
+	}
+	if index := strings.Index(providerARN, ":oidc-provider/"); index != -1 {
+		return providerARN[index+len(":oidc-provider/"):]
+	}
+	return ""
+}
+
+// ServiceAccountSubject will return the subject of the service account tokens
+func ServiceAccountSubject(namespace, serviceAccount string) string {
+	return "system:serviceaccount:" + namespace + ":" + serviceAccount
+}
+
+// The condition operators of the trust statements, the subjects with wildcards are matched with StringLike
+const (
+	operatorEquals = "StringEquals"
+	operatorLike   = "StringLike"
+)
+
+// resolvedSubject is a subject of the trust policy along with the OIDC provider it is trusted through
+type resolvedSubject struct {
+	ProviderARN string
+	IssuerHost  string
+	Subject     string
+}
+
+// operator will return the condition operator matching the subject
+func (s resolvedSubject) operator() string {
+	if strings.ContainsAny(s.Subject, "*?") {
+		return operatorLike
+	}
+	return operatorEquals
+}
+
+// ParseTrustSubject will parse a trust subject of the form <namespace>:<service-account>[@<provider-url>]
+func ParseTrustSubject(value string) (types.TrustSubject, error) {
+	var subject types.TrustSubject
+	serviceAccount := value
+	if index := strings.Index(value, "@"); index != -1 {
+		subject.ProviderUrl = value[index+1:]
+		serviceAccount = value[:index]
+	}
+	parts := strings.Split(serviceAccount, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return subject, errors.Errorf("invalid trust subject '%v', expected <namespace>:<service-account>[@<provider-url>]", value)
+	}
+	subject.Namespace, subject.ServiceAccount = parts[0], parts[1]
+	return subject, nil
+}
+
+// trustSubjects will resolve the subjects trusted by the chaos role, the experiment service account followed by
+// the extra subjects of the params
+func trustSubjects(params types.OnboardingParameters) ([]resolvedSubject, error) {
+	subjects := append([]types.TrustSubject{{
+		ProviderUrl:    params.ProviderUrl,
+		Namespace:      params.Infra.Namespace,
+		ServiceAccount: params.ExperimentServiceAccountName,
+	}}, params.TrustSubjects...)
+	return resolveSubjects(subjects, params)
+}
+
+// resolveSubjects will look up the OIDC provider of each subject, the subjects without a provider URL are
+// trusted through the provider of the infra
+func resolveSubjects(subjects []types.TrustSubject, params types.OnboardingParameters) ([]resolvedSubject, error) {
+
+	providerARNs := map[string]string{}
+	if params.ProviderARN != "" {
+		providerARNs[IssuerHost(params.ProviderUrl, params.ProviderARN)] = params.ProviderARN
+	}
+
+	var resolved []resolvedSubject
+	for _, subject := range subjects {
+		if subject.Namespace == "" || subject.ServiceAccount == "" {
+			return nil, errors.Errorf("invalid trust subject '%v:%v', the namespace and service account are required", subject.Namespace, subject.ServiceAccount)
+		}
+		providerURL := subject.ProviderUrl
+		if providerURL == "" {
+			providerURL = params.ProviderUrl
+		}
+		issuerHost := IssuerHost(providerURL, "")
+		if issuerHost == "" {
+			if issuerHost = IssuerHost("", params.ProviderARN); issuerHost == "" {
+				return nil, errors.Errorf("the OIDC provider is needed to build the trust policy, provide --provider-url")
+			}
+		}
+		providerARN, ok := providerARNs[issuerHost]
+		if !ok {
+			arn, err := getProviderArn("https://"+issuerHost, params)
+			if err != nil {
+				return nil, err
+			}
+			providerARN = arn
+			providerARNs[issuerHost] = arn
+		}
+		resolved = append(resolved, resolvedSubject{
+			ProviderARN: providerARN,
+			IssuerHost:  issuerHost,
+			Subject:     ServiceAccountSubject(subject.Namespace, subject.ServiceAccount),
+		})
+	}
+	return resolved, nil
+}
+
+// NewIRSAStatement will build the statement allowing the given subjects to assume the role through the OIDC
+// provider, the token must carry one of the subjects and sts as audience
+func NewIRSAStatement(providerARN, issuerHost, operator string, subjects []string) TrustStatement {
+	var sub interface{} = subjects
+	if len(subjects) == 1 {
+		sub = subjects[0]
+	}
+	condition := map[string]map[string]interface{}{
+		operatorEquals: {issuerHost + ":aud": stsAudience},
+	}
+	if condition[operator] == nil {
+		condition[operator] = map[string]interface{}{}
+	}
+	condition[operator][issuerHost+":sub"] = sub
+	return TrustStatement{
+		Effect:    "Allow",
+		Principal: TrustPrincipal{Federated: providerARN},
+		Action:    webIdentityAction,
+		Condition: condition,
+	}
+}
+
+// TrustPolicyDocument will return the trust policy allowing the experiment service account and the extra trust
+// subjects to assume the role, with one statement per OIDC provider and condition operator
+func TrustPolicyDocument(params types.OnboardingParameters) (string, error) {
+	subjects, err := trustSubjects(params)
+	if err != nil {
+		return "", err
+	}
+
+	type trustGroup struct {
+		subject  resolvedSubject
+		operator string
+	}
+	var keys []trustGroup
+	grouped := map[trustGroup][]string{}
+	seen := map[resolvedSubject]bool{}
+	for _, subject := range subjects {
+		if seen[subject] {
+			continue
+		}
+		seen[subject] = true
+		key := trustGroup{subject: resolvedSubject{ProviderARN: subject.ProviderARN, IssuerHost: subject.IssuerHost}, operator: subject.operator()}
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], subject.Subject)
+	}
+
+	policy := TrustPolicy{Version: "2012-10-17"}
+	for _, key := range keys {
+		policy.Statement = append(policy.Statement, NewIRSAStatement(key.subject.ProviderARN, key.subject.IssuerHost, key.operator, grouped[key]))
+	}
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return "", errors.Errorf("failed to prepare the trust policy JSON, err: %v", err)
+	}
+	return string(document), nil
+}
+
+// TrustVerification is the result of evaluating a trust policy for the token of the experiment service account
+type TrustVerification struct {
+	RoleName       string   `json:"roleName"`
+	ProviderARN    string   `json:"providerARN"`
+	Subject        string   `json:"subject"`
+	TrustsProvider bool     `json:"trustsProvider"`
+	CanAssume      bool     `json:"canAssume"`
+	Reasons        []string `json:"reasons,omitempty"`
+}
+
+// VerifyRoleTrust will decode the trust policy of the given role and check if the experiment service account can
+// assume it through the OIDC provider of the cluster
+func VerifyRoleTrust(roleName string, params types.OnboardingParameters) (TrustVerification, error) {
+
+	providerARN := params.ProviderARN
+	if providerARN == "" {
+		if params.ProviderUrl == "" {
+			return TrustVerification{}, errors.Errorf("the OIDC provider is needed to verify the trust policy, provide --provider-url")
+		}
+		arn, err := getProviderArn(params.ProviderUrl, params)
+		if err != nil {
+			return TrustVerification{}, err
+		}
+		providerARN = arn
+	}
+
+	document, err := GetTrustPolicy(roleName, params)
+	if err != nil {
+		return TrustVerification{}, err
+	}
+
+	verification, err := VerifyTrust(document, providerARN, IssuerHost(params.ProviderUrl, providerARN), params.Infra.Namespace, params.ExperimentServiceAccountName)
+	verification.RoleName = roleName
+	return verification, err
+}
+
+// VerifyTrust will evaluate the trust policy document for the token of the given service account, issued by the
+// OIDC provider. The role can be assumed when an Allow statement matches and no Deny statement does.
+func VerifyTrust(document, providerARN, issuerHost, namespace, serviceAccount string) (TrustVerification, error) {
+
+	verification := TrustVerification{ProviderARN: providerARN, Subject: ServiceAccountSubject(namespace, serviceAccount)}
+
+	statements, err := trustStatements(document)
+	if err != nil {
+		return verification, err
+	}
+
+	// The claims of the projected service account token
+	claims := map[string]string{
+		issuerHost + ":sub": verification.Subject,
+		issuerHost + ":aud": stsAudience,
+	}
+
+	allowed, denied := false, false
+	for i, statement := range statements {
+		if !statement.allowsAction(webIdentityAction) || !statement.hasFederatedPrincipal(providerARN) {
+			continue
+		}
+		if statement.Effect == "Allow" {
+			verification.TrustsProvider = true
+		}
+		matched, reason := statement.conditionsMatch(claims)
+		if !matched {
+			if statement.Effect == "Allow" {
+				verification.Reasons = append(verification.Reasons, "statement "+strconv.Itoa(i+1)+": "+reason)
+			}
+			continue
+		}
+		switch statement.Effect {
+		case "Allow":
+			allowed = true
+		case "Deny":
+			denied = true
+			verification.Reasons = append(verification.Reasons, "statement "+strconv.Itoa(i+1)+": denies the service account")
+		}
+	}
+
+	if !verification.TrustsProvider {
+		verification.Reasons = append(verification.Reasons, "no statement allows "+webIdentityAction+" for the OIDC provider "+providerARN)
+	}
+	verification.CanAssume = allowed && !denied
+	if verification.CanAssume {
+		verification.Reasons = nil
+	}
+	return verification, nil
+}
+
+// trustStatement is a statement of a trust policy read from IAM, whose elements can either be strings or lists
+type trustStatement struct {
+	Effect    string
+	Principal json.RawMessage
+	Action    json.RawMessage
+	Condition map[string]map[string]json.RawMessage
+}
+
+// trustStatements will decode the statements of the trust policy document
+func trustStatements(document string) ([]trustStatement, error) {
+
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, errors.Errorf("failed to parse trust policy, err: %v", err)
+	}
+
+	// The Statement can either be a single statement or a list of statements
+	var statements []trustStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var statement trustStatement
+		if err := json.Unmarshal(policy.Statement, &statement); err != nil {
+			return nil, errors.Errorf("failed to parse trust policy statement, err: %v", err)
+		}
+		statements = []trustStatement{statement}
+	}
+	return statements, nil
+}
+
+// allowsAction will check if the actions of the statement match the given action
+func (s trustStatement) allowsAction(action string) bool {
+	if len(s.Action) == 0 {
+		return false
+	}
+	actions, err := stringOrSlice(s.Action)
+	if err != nil {
+		return false
+	}
+	return actionGranted(actions, action)
+}
+
+// hasFederatedPrincipal will check if the given OIDC provider is a federated principal of the statement
+func (s trustStatement) hasFederatedPrincipal(providerARN string) bool {
+	var principal struct {
+		Federated json.RawMessage
+	}
+	if err := json.Unmarshal(s.Principal, &principal); err != nil || len(principal.Federated) == 0 {
+		return false
+	}
+	federated, err := stringOrSlice(principal.Federated)
+	if err != nil {
+		return false
+	}
+	for _, arn := range federated {
+		if arn == providerARN {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionsMatch will evaluate the conditions of the statement against the token claims, every condition must
+// match. The reason is returned when they don't.
+func (s trustStatement) conditionsMatch(claims map[string]string) (bool, string) {
+	for _, operator := range sortedKeys(s.Condition) {
+		conditions := s.Condition[operator]
+		for _, key := range sortedKeys(conditions) {
+			raw := conditions[key]
+			values, err := stringOrSlice(raw)
+			if err != nil {
+				return false, "invalid value of condition " + operator + " " + key
+			}
+			claim, ok := claims[key]
+			if !ok {
+				return false, "the token has no claim for condition " + operator + " " + key
+			}
+			matched, supported := evaluateCondition(operator, claim, values)
+			if !supported {
+				return false, "unsupported condition operator " + operator
+			}
+			if !matched {
+				return false, "condition " + operator + " " + key + " " + strings.Join(values, ",") + " doesn't match '" + claim + "'"
+			}
+		}
+	}
+	return true, ""
+}
+
+// evaluateCondition will evaluate the string condition operator for the claim
+func evaluateCondition(operator, claim string, values []string) (bool, bool) {
+	operator = strings.TrimPrefix(strings.TrimPrefix(operator, "ForAnyValue:"), "ForAllValues:")
+	negate := false
+	switch {
+	case strings.HasPrefix(operator, "StringNot"):
+		negate = true
+		operator = "String" + strings.TrimPrefix(operator, "StringNot")
+	}
+
+	matched := false
+	for _, value := range values {
+		switch operator {
+		case "StringEquals":
+			matched = matched || claim == value
+		case "StringEqualsIgnoreCase":
+			matched = matched || strings.EqualFold(claim, value)
+		case "StringLike":
+			matched = matched || likeMatch(value, claim)
+		default:
+			return false, false
+		}
+	}
+	if negate {
+		return !matched, true
+	}
+	return matched, true
+}
+
+// sortedKeys will return the keys of the map in order, so the conditions are evaluated deterministically
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// likeMatch will match the value against the StringLike pattern, where '*' matches any characters and '?' a single one
+func likeMatch(pattern, value string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+	matched, _ := regexp.MatchString("^"+expression+"$", value)
+	return matched
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyTrust(t *testing.T) {
+
+	subject := ServiceAccountSubject("hce", "litmus-admin")
+	otherProvider := "arn:aws:iam::123456789012:oidc-provider/oidc.eks.eu-west-1.amazonaws.com/id/OTHER"
+
+	tests := []struct {
+		name          string
+		document      string
+		wantAssume    bool
+		wantProvider  bool
+		wantReasonHas string
+	}{
+		{
+			name:         "exact subject",
+			document:     testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{subject})),
+			wantAssume:   true,
+			wantProvider: true,
+		},
+		{
+			name:         "wildcard subject with StringLike",
+			document:     testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorLike, []string{"system:serviceaccount:hce:*"})),
+			wantAssume:   true,
+			wantProvider: true,
+		},
+		{
+			name:          "wildcard subject with StringEquals is taken literally",
+			document:      testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{"system:serviceaccount:hce:*"})),
+			wantProvider:  true,
+			wantReasonHas: "doesn't match '" + subject + "'",
+		},
+		{
+			name:          "other service account",
+			document:      testTrustDocument(t, NewIRSAStatement(testProviderARN, testIssuerHost, operatorEquals, []string{ServiceAccountSubject("hce", "other")})),
+			wantProvider:  true,
+			wantReasonHas: "statement 1: condition StringEquals",
+		},
+		{
+			name:          "other OIDC provider",
+			document:      testTrustDocument(t, NewIRSAStatement(otherProvider, testIssuerHost, operatorEquals, []string{subject})),
+			wantReasonHas: "no statement allows sts:AssumeRoleWithWebIdentity for the OIDC provider",
+		},
+		{
+			name: "deny statement wins over the allow",
+			document: testTrustDocument(t,
+				NewIRSAStatement(testProviderARN, testIssuerHost, operatorLike, []string{"system:serviceaccount:*"}),
+				TrustStatement{
+					Effect:    "Deny",
+					Principal: TrustPrincipal{Federated: testProviderARN},
+					Action:    webIdentityAction,
+					Condition: map[string]map[string]interface{}{operatorEquals: {testIssuerHost + ":sub": subject}},
+				}),
+			wantProvider:  true,
+			wantReasonHas: "statement 2: denies the service account",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verification, err := VerifyTrust(tt.document, testProviderARN, testIssuerHost, "hce", "litmus-admin")
+			if err != nil {
+				t.Fatalf("VerifyTrust() unexpected err: %v", err)
+			}
+			if verification.CanAssume != tt.wantAssume || verification.TrustsProvider != tt.wantProvider {
+				t.Errorf("VerifyTrust() canAssume = %v, trustsProvider = %v, want %v, %v", verification.CanAssume, verification.TrustsProvider, tt.wantAssume, tt.wantProvider)
+			}
+			if reasons := strings.Join(verification.Reasons, "\n"); !strings.Contains(reasons, tt.wantReasonHas) {
+				t.Errorf("VerifyTrust() reasons %q, want %q", reasons, tt.wantReasonHas)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package aws
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// maxPolicyVersions is the number of versions IAM keeps for a managed policy
+const maxPolicyVersions = 5
+
+// PolicyUpdate is the change to a chaos policy needed to grant the generated document
+type PolicyUpdate struct {
+	PolicyName     string   `json:"policyName"`
+	PolicyARN      string   `json:"policyARN"`
+	Exists         bool     `json:"exists"`
+	Adopt          bool     `json:"adopt,omitempty"`
+	Changed        bool     `json:"changed"`
+	DefaultVersion string   `json:"defaultVersion,omitempty"`
+	PruneVersion   string   `json:"pruneVersion,omitempty"`
+	Added          []string `json:"added,omitempty"`
+	Removed        []string `json:"removed,omitempty"`
+	Diff           string   `json:"diff,omitempty"`
+	Document       string   `json:"-"`
+}
+
+// PlanPolicyUpdates will compare the default version of each chaos policy with the generated document, without
+// changing any of them
+func PlanPolicyUpdates(policies []Policy, params types.OnboardingParameters) ([]PolicyUpdate, error) {
+
+	accountID, err := GetAccountID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := Session(params)
+	if err != nil {
+		return nil, err
+	}
+	svc := iam.New(sess)
+
+	var updates []PolicyUpdate
+	for i, policy := range policies {
+		policyName, err := PolicyName(params, i)
+		if err != nil {
+			return nil, err
+		}
+		update, err := planPolicyUpdate(svc, policy, policyName, PolicyARN(accountID, params.IAM.Path, policyName), params)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// planPolicyUpdate will compare the default version of the policy with the generated document. A new version is
+// needed when they differ, and the oldest non-default version is pruned when the version limit is reached.
+func planPolicyUpdate(svc *iam.IAM, policy Policy, policyName, policyARN string, params types.OnboardingParameters) (PolicyUpdate, error) {
+
+	document, err := json.Marshal(policy)
+	if err != nil {
+		return PolicyUpdate{}, errors.Errorf("failed to prepare the policy document, err: %v", err)
+	}
+	update := PolicyUpdate{PolicyName: policyName, PolicyARN: policyARN, Document: string(document)}
+
+	current, err := svc.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		if !isNotFound(err) {
+			return PolicyUpdate{}, errors.Errorf("failed to get policy '%v', err: %v", policyARN, err)
+		}
+		update.Changed = true
+		update.Added, update.Removed, err = diffActions(`{"Statement":[]}`, update.Document)
+		return update, err
+	}
+	if !isManaged(current.Policy.Tags) {
+		// The policy created by an earlier version of this cli is not tagged, it is adopted when it has its name
+		if !isLegacyName(policyName, policyPrefix, params) {
+			return PolicyUpdate{}, errors.Errorf("the policy '%v' already exists and was not created by this cli", policyARN)
+		}
+		update.Adopt = true
+	}
+	if err := checkCluster("policy '"+policyARN+"'", current.Policy.Tags, params); err != nil {
+		return PolicyUpdate{}, err
+	}
+	update.Exists = true
+	update.DefaultVersion = aws.StringValue(current.Policy.DefaultVersionId)
+
+	version, err := svc.GetPolicyVersion(&iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyARN),
+		VersionId: current.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return PolicyUpdate{}, errors.Errorf("failed to get version '%v' of policy '%v', err: %v", update.DefaultVersion, policyARN, err)
+	}
+	currentDocument, err := url.QueryUnescape(aws.StringValue(version.PolicyVersion.Document))
+	if err != nil {
+		return PolicyUpdate{}, errors.Errorf("failed to decode version '%v' of policy '%v', err: %v", update.DefaultVersion, policyARN, err)
+	}
+	if normalizeDocument(currentDocument) == normalizeDocument(update.Document) {
+		return update, nil
+	}
+
+	update.Changed = true
+	if update.Added, update.Removed, err = diffActions(currentDocument, update.Document); err != nil {
+		return PolicyUpdate{}, err
+	}
+	update.Diff = LineDiff(indentJSON(normalizeDocument(currentDocument)), indentJSON(normalizeDocument(update.Document)))
+
+	versions, err := svc.ListPolicyVersions(&iam.ListPolicyVersionsInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return PolicyUpdate{}, errors.Errorf("failed to list the versions of policy '%v', err: %v", policyARN, err)
+	}
+	if len(versions.Versions) >= maxPolicyVersions {
+		update.PruneVersion = oldestVersion(versions.Versions)
+	}
+	return update, nil
+}
+
+// adoptPolicy will tag the policy created by an earlier version of this cli, so it is managed like the created ones
+func adoptPolicy(update PolicyUpdate, params types.OnboardingParameters) error {
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+
+	if _, err := svc.TagPolicy(&iam.TagPolicyInput{
+		PolicyArn: aws.String(update.PolicyARN),
+		Tags:      resourceTags(params),
+	}); err != nil {
+		return iamError("tag policy '"+update.PolicyARN+"'", err)
+	}
+	log.Infof("[Info]: Adopted the policy '%v' created by an earlier version of this cli", update.PolicyName)
+	return nil
+}
+
+// updatePolicy will create a new default version of the policy with the generated document, after pruning the
+// oldest non-default version when the version limit is reached
+func updatePolicy(update PolicyUpdate, params types.OnboardingParameters) error {
+
+	sess, err := Session(params)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+
+	if update.PruneVersion != "" {
+		if _, err := svc.DeletePolicyVersion(&iam.DeletePolicyVersionInput{
+			PolicyArn: aws.String(update.PolicyARN),
+			VersionId: aws.String(update.PruneVersion),
+		}); err != nil {
+			return errors.Errorf("failed to delete version '%v' of policy '%v', err: %v", update.PruneVersion, update.PolicyARN, err)
+		}
+		log.Infof("[Info]: Deleted the oldest version '%v' of policy '%v'", update.PruneVersion, update.PolicyName)
+	}
+
+	version, err := svc.CreatePolicyVersion(&iam.CreatePolicyVersionInput{
+		PolicyArn:      aws.String(update.PolicyARN),
+		PolicyDocument: aws.String(update.Document),
+		SetAsDefault:   aws.Bool(true),
+	})
+	if err != nil {
+		return errors.Errorf("failed to create a new version of policy '%v', err: %v", update.PolicyARN, err)
+	}
+	log.Infof("[Info]: The policy '%v' is updated to version '%v', added actions: %v, removed actions: %v",
+		update.PolicyName, aws.StringValue(version.PolicyVersion.VersionId), listOrNone(update.Added), listOrNone(update.Removed))
+	return nil
+}
+
+// diffActions will return the actions allowed by the new document and not by the current one, and the other way around
+func diffActions(current, desired string) ([]string, []string, error) {
+	currentActions, err := allowedActions(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	desiredActions, err := allowedActions(desired)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subtract(desiredActions, currentActions), subtract(currentActions, desiredActions), nil
+}
+
+// subtract will return the sorted actions of a which are not in b
+func subtract(a, b []string) []string {
+	exclude := map[string]bool{}
+	for _, action := range b {
+		exclude[action] = true
+	}
+	var result []string
+	for _, action := range a {
+		if !exclude[action] {
+			exclude[action] = true
+			result = append(result, action)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// oldestVersion will return the ID of the oldest non-default version of the policy
+func oldestVersion(versions []*iam.PolicyVersion) string {
+	var oldest *iam.PolicyVersion
+	for _, version := range versions {
+		if aws.BoolValue(version.IsDefaultVersion) {
+			continue
+		}
+		if oldest == nil || aws.TimeValue(version.CreateDate).Before(aws.TimeValue(oldest.CreateDate)) {
+			oldest = version
+		}
+	}
+	if oldest == nil {
+		return ""
+	}
+	return aws.StringValue(oldest.VersionId)
+}
+
+// listOrNone will format the list for the logs
+func listOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ", ")
+}
@@ -1,15 +1,12 @@
 package clients
 
 import (
-	"os"
-
 	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // ClientSets is a collection of clientSets and kubeConfig needed
@@ -17,15 +14,69 @@ type ClientSets struct {
 	KubeClient    *kubernetes.Clientset
 	KubeConfig    *rest.Config
 	DynamicClient dynamic.Interface
+	// Context is the kubeconfig context, or the EKS cluster, the clients connect to
+	Context string
 }
 
-// GenerateClientSetFromKubeConfig will generation both ClientSets (k8s, and Litmus) as well as the KubeConfig
-func (clientSets *ClientSets) GenerateClientSetFromKubeConfig() error {
+// Options are the settings of the clients, the EKS cluster is connected to without a kubeconfig when it is set
+type Options struct {
+	KubeConfigPath    string
+	EKSClusterName    string
+	Region            string
+	AWSProfile        string
+	AWSCredentialFile string
+	types.KubeOptions
+}
 
-	config, err := getKubeConfig()
+// NewOptions will return the client options of the params
+func NewOptions(params types.OnboardingParameters) Options {
+	return Options{
+		KubeConfigPath:    params.KubeConfigPath,
+		EKSClusterName:    params.EKSClusterName,
+		Region:            params.Region,
+		AWSProfile:        params.AWSProfile,
+		AWSCredentialFile: params.AWSCredentialFile,
+		KubeOptions:       params.Kube,
+	}
+}
+
+// GenerateClientSet will generate the ClientSets of the EKS cluster of the options when it is set, and of the
+// kubeconfig otherwise
+func (clientSets *ClientSets) GenerateClientSet(options Options) error {
+
+	var config *rest.Config
+	var err error
+	if options.EKSClusterName != "" {
+		if options.Context != "" {
+			return errors.New("the kube context can't be selected for an EKS cluster, use either --kube-context or --eks-cluster-name")
+		}
+		config, err = eksConfig(options)
+		clientSets.Context = "eks:" + options.EKSClusterName
+	} else {
+		config, clientSets.Context, err = kubeConfig(options)
+	}
 	if err != nil {
 		return err
 	}
+
+	if options.As != "" {
+		config.Impersonate.UserName = options.As
+	}
+	if options.QPS != 0 {
+		config.QPS = options.QPS
+	}
+	if options.Burst != 0 {
+		config.Burst = options.Burst
+	}
+	// A QPS without burst is rejected by client-go
+	if config.QPS != 0 && config.Burst == 0 {
+		config.Burst = rest.DefaultBurst
+	}
+	return clientSets.generate(config)
+}
+
+// generate will generate the ClientSets of the config
+func (clientSets *ClientSets) generate(config *rest.Config) error {
 	k8sClientSet, err := generateK8sClientSet(config)
 	if err != nil {
 		return err
@@ -40,16 +91,32 @@ func (clientSets *ClientSets) GenerateClientSetFromKubeConfig() error {
 	return nil
 }
 
-// getKubeConfig setup the config for access cluster resource
-func getKubeConfig() (*rest.Config, error) {
-	kubeconfig := os.Getenv("KUBECONFIG")
-	// If KUBECONFIG is not specified, look at the default location
-	if kubeconfig == "" {
-		kubeconfig = os.Getenv("HOME") + "/.kube/config"
+// kubeConfig will build the config of the context of the kubeconfig, the path of the options or else the KUBECONFIG
+// files or $HOME/.kube/config. Without any kubeconfig, it falls back to the in-cluster config.
+func kubeConfig(options Options) (*rest.Config, string, error) {
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = options.KubeConfigPath
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: options.Context})
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		if clientcmd.IsEmptyConfig(err) && options.Context == "" {
+			if inCluster, inClusterErr := rest.InClusterConfig(); inClusterErr == nil {
+				return inCluster, "in-cluster", nil
+			}
+		}
+		return nil, "", errors.Errorf("failed to load the kubeconfig, err: %v", err)
 	}
-	// It uses in-cluster config, if kubeconfig path is not specified
-	config, err := buildConfigFromFlags("", kubeconfig)
-	return config, err
+	context := options.Context
+	if context == "" {
+		raw, err := loader.RawConfig()
+		if err != nil {
+			return nil, "", errors.Errorf("failed to load the kubeconfig, err: %v", err)
+		}
+		context = raw.CurrentContext
+	}
+	return config, context, nil
 }
 
 // generateK8sClientSet will generation k8s client
@@ -60,17 +127,3 @@ func generateK8sClientSet(config *rest.Config) (*kubernetes.Clientset, error) {
 	}
 	return k8sClientSet, nil
 }
-
-// buildConfigFromFlags is a helper function that builds configs from a master
-// url or a kubeconfig filepath, if nothing is provided it falls back to inClusterConfig
-func buildConfigFromFlags(masterUrl, kubeconfigPath string) (*restclient.Config, error) {
-	if kubeconfigPath == "" && masterUrl == "" {
-		kubeconfig, err := restclient.InClusterConfig()
-		if err == nil {
-			return kubeconfig, nil
-		}
-	}
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: masterUrl}}).ClientConfig()
-}
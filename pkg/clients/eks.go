@@ -0,0 +1,107 @@
+package clients
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+	hceaws "github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// eksTokenPrefix is the prefix of the bearer tokens accepted by the EKS api server
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksClusterHeader is the header binding the presigned request to the cluster
+	eksClusterHeader = "x-k8s-aws-id"
+	// eksTokenLifetime is how long the api server accepts a token, it is refreshed a minute earlier
+	eksTokenLifetime = 15 * time.Minute
+	eksTokenRefresh  = time.Minute
+)
+
+// eksConfig will build the config of the EKS cluster from its endpoint and CA. The requests are authenticated with
+// a presigned STS GetCallerIdentity request, the token which 'aws eks get-token' generates, so neither a kubeconfig
+// nor the aws cli is needed.
+func eksConfig(options Options) (*rest.Config, error) {
+
+	clusterName, region := options.EKSClusterName, options.Region
+	sess, err := hceaws.NewSession(region, options.AWSProfile, options.AWSCredentialFile)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := eks.New(sess).DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return nil, errors.Errorf("failed to describe EKS cluster '%v' in region '%v', err: %v", clusterName, region, err)
+	}
+	if aws.StringValue(cluster.Cluster.Endpoint) == "" || cluster.Cluster.CertificateAuthority == nil {
+		return nil, errors.Errorf("the EKS cluster '%v' has no endpoint yet, its status is %v", clusterName, aws.StringValue(cluster.Cluster.Status))
+	}
+	caData, err := base64.StdEncoding.DecodeString(aws.StringValue(cluster.Cluster.CertificateAuthority.Data))
+	if err != nil {
+		return nil, errors.Errorf("failed to decode the CA of EKS cluster '%v', err: %v", clusterName, err)
+	}
+
+	tokens := &eksTokenSource{clusterName: clusterName, svc: sts.New(sess)}
+	// The first token is generated now, so invalid credentials fail before any request
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
+	}
+	return &rest.Config{
+		Host:            aws.StringValue(cluster.Cluster.Endpoint),
+		TLSClientConfig: rest.TLSClientConfig{CAData: caData},
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &eksRoundTripper{base: rt, tokens: tokens}
+		},
+	}, nil
+}
+
+// eksTokenSource generates the bearer tokens of the EKS cluster, a token is reused until it is about to expire
+type eksTokenSource struct {
+	clusterName string
+	svc         *sts.STS
+	mu          sync.Mutex
+	token       string
+	expiry      time.Time
+}
+
+// Token will return a valid token, generating a new one when the current one is about to expire
+func (s *eksTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+	req, _ := s.svc.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterHeader, s.clusterName)
+	// The api server only checks the signing time, the presign expiry doesn't extend the lifetime of the token
+	presigned, err := req.Presign(time.Minute)
+	if err != nil {
+		return "", errors.Errorf("failed to generate the token of EKS cluster '%v', err: %v", s.clusterName, err)
+	}
+	s.token = eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned))
+	s.expiry = time.Now().Add(eksTokenLifetime - eksTokenRefresh)
+	return s.token, nil
+}
+
+// eksRoundTripper sets the current token of the EKS cluster on every request
+type eksRoundTripper struct {
+	base   http.RoundTripper
+	tokens *eksTokenSource
+}
+
+// RoundTrip will send the request with the bearer token
+func (rt *eksRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return rt.base.RoundTrip(req)
+}
@@ -0,0 +1,508 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/state"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion and Kind identify the versioned config file
+	APIVersion = "hce.harness.io/v1"
+	Kind       = "OnboardingConfig"
+)
+
+// envPattern matches the ${NAME} references to environment variables, $${ escapes a literal ${
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Document is the versioned config file, the defaults are merged into each infra
+type Document struct {
+	APIVersion string  `json:"apiVersion" description:"Version of the config file schema" enum:"hce.harness.io/v1"`
+	Kind       string  `json:"kind" description:"Kind of the config file" enum:"OnboardingConfig"`
+	Defaults   Entry   `json:"defaults,omitempty" description:"Settings shared by every infra, an infra overrides them"`
+	Infras     []Entry `json:"infras" description:"Infras to onboard"`
+}
+
+// Entry is the onboarding of a single infra
+type Entry struct {
+	APIKey          string           `json:"apiKey,omitempty" description:"API key of Harness"`
+	AccountID       string           `json:"accountId,omitempty" description:"Account ID of Harness"`
+	Organisation    string           `json:"organisation,omitempty" description:"Organisation identifier (default 'default')"`
+	Project         string           `json:"project,omitempty" description:"Project identifier"`
+	Infra           InfraEntry       `json:"infra,omitempty" description:"Chaos infra to register"`
+	Environment     EnvironmentEntry `json:"environment,omitempty" description:"Environment of the chaos infra"`
+	Actions         string           `json:"actions,omitempty" description:"Comma separated steps and aliases performed (default all)"`
+	CreateNamespace bool             `json:"createNamespace,omitempty" description:"Create the infra namespace"`
+	DryRun          bool             `json:"dryRun,omitempty" description:"Show the planned changes without making any of them"`
+	Timeout         int              `json:"timeout,omitempty" description:"Timeout of the infra setup in seconds (default 180)"`
+	Delay           int              `json:"delay,omitempty" description:"Delay between the checks of the infra status in seconds (default 2)"`
+	AWS             AWSEntry         `json:"aws,omitempty" description:"AWS account of the chaos role"`
+	Kube            KubeEntry        `json:"kube,omitempty" description:"Cluster of the chaos infra"`
+}
+
+// InfraEntry is the chaos infra of an entry
+type InfraEntry struct {
+	Name                 string `json:"name,omitempty" description:"Name of the chaos infra"`
+	Namespace            string `json:"namespace,omitempty" description:"Namespace of the chaos infra (default hce)"`
+	Description          string `json:"description,omitempty" description:"Description of the chaos infra"`
+	PlatformName         string `json:"platformName,omitempty" description:"Platform name of the chaos infra"`
+	Scope                string `json:"scope,omitempty" description:"Scope of the chaos infra, namespace or cluster (default namespace)"`
+	NamespaceExists      bool   `json:"namespaceExists,omitempty" description:"The namespace of the chaos infra exists (default true)"`
+	ServiceAccount       string `json:"serviceAccount,omitempty" description:"Service account of the chaos infra (default hce)"`
+	ServiceAccountExists bool   `json:"serviceAccountExists,omitempty" description:"The service account of the chaos infra exists"`
+	AutoUpgrade          bool   `json:"autoUpgrade,omitempty" description:"Upgrade the chaos infra automatically"`
+	SkipSSL              bool   `json:"skipSsl,omitempty" description:"Skip the SSL verification of the chaos infra"`
+}
+
+// EnvironmentEntry is the environment of an entry
+type EnvironmentEntry struct {
+	Name        string `json:"name,omitempty" description:"Name of the environment"`
+	Description string `json:"description,omitempty" description:"Description of the environment"`
+	Type        string `json:"type,omitempty" description:"Type of the environment (default PreProduction)" enum:"PreProduction,Production"`
+}
+
+// AWSEntry is the aws account and chaos role of an entry
+type AWSEntry struct {
+	Region                   string              `json:"region,omitempty" description:"Target AWS region"`
+	Profile                  string              `json:"profile,omitempty" description:"AWS profile (default 'default')"`
+	CredentialFile           string              `json:"credentialFile,omitempty" description:"Path of the AWS credentials file"`
+	ProviderURL              string              `json:"providerUrl,omitempty" description:"OIDC issuer of the cluster, discovered from the cluster when not set"`
+	EKSClusterName           string              `json:"eksClusterName,omitempty" description:"Name of the EKS cluster to connect to, without a kubeconfig"`
+	Thumbprint               string              `json:"thumbprint,omitempty" description:"Thumbprint of the OIDC provider, computed from the issuer when not set"`
+	CABundle                 string              `json:"caBundle,omitempty" description:"PEM file of CA certificates trusted to verify the issuer"`
+	RoleName                 string              `json:"roleName,omitempty" description:"Existing role used as chaos role"`
+	ExperimentServiceAccount string              `json:"experimentServiceAccount,omitempty" description:"Service account of the chaos experiments (default litmus-admin)"`
+	Resources                []string            `json:"resources,omitempty" description:"Resource groups granted by the chaos policy (default all, unless faults are set)"`
+	Faults                   []string            `json:"faults,omitempty" description:"Faults granted the minimal permissions by the chaos policy"`
+	PolicyCatalog            string              `json:"policyCatalog,omitempty" description:"Directory of policy catalog files"`
+	Scope                    ScopeEntry          `json:"scope,omitempty" description:"Restrictions of the mutating actions of the chaos policy"`
+	Guardrails               []GuardrailEntry    `json:"guardrails,omitempty" description:"Guardrails denying the chaos actions on protected resources"`
+	TrustSubjects            []TrustSubjectEntry `json:"trustSubjects,omitempty" description:"Extra service accounts trusted by the chaos role"`
+	IAM                      IAMEntry            `json:"iam,omitempty" description:"Organisation requirements of the created IAM resources"`
+	Naming                   NamingEntry         `json:"naming,omitempty" description:"Naming of the created role and policies"`
+}
+
+// ScopeEntry restricts the mutating actions of the chaos policy
+type ScopeEntry struct {
+	Tags         map[string]string `json:"tags,omitempty" description:"Tags the resources must have"`
+	ResourceARNs []string          `json:"resourceARNs,omitempty" description:"ARNs the mutating actions of their service are limited to"`
+	Regions      []string          `json:"regions,omitempty" description:"Regions the mutating actions are limited to"`
+	VPCs         []string          `json:"vpcs,omitempty" description:"VPC IDs the mutating network actions are limited to"`
+}
+
+// GuardrailEntry denies the chaos actions against protected resources
+type GuardrailEntry struct {
+	Name          string            `json:"name,omitempty" description:"Name of the guardrail"`
+	Tags          map[string]string `json:"tags,omitempty" description:"Tags of the protected resources"`
+	InstanceIDs   []string          `json:"instanceIDs,omitempty" description:"IDs of the protected EC2 instances"`
+	DBInstanceIDs []string          `json:"dbInstanceIDs,omitempty" description:"Identifiers of the protected RDS DB instances"`
+	Regions       []string          `json:"regions,omitempty" description:"Protected regions"`
+	Actions       []string          `json:"actions,omitempty" description:"Denied actions (default every mutating action of the chaos policy)"`
+}
+
+// TrustSubjectEntry is a service account trusted by the chaos role
+type TrustSubjectEntry struct {
+	Namespace      string `json:"namespace" description:"Namespace of the service account, can contain * and ? wildcards"`
+	ServiceAccount string `json:"serviceAccount" description:"Name of the service account, can contain * and ? wildcards"`
+	ProviderURL    string `json:"providerUrl,omitempty" description:"OIDC issuer of the cluster of the service account (default the one of the infra)"`
+}
+
+// IAMEntry are the organisation requirements of the created IAM resources
+type IAMEntry struct {
+	PermissionsBoundary string            `json:"permissionsBoundary,omitempty" description:"ARN of the permissions boundary of the created role"`
+	Tags                map[string]string `json:"tags,omitempty" description:"Tags of the created role, policies and OIDC provider"`
+	Path                string            `json:"path,omitempty" description:"Path of the created role and policies (default /)"`
+	Description         string            `json:"description,omitempty" description:"Description of the created role and policies"`
+	MaxSessionDuration  int               `json:"maxSessionDuration,omitempty" description:"Maximum session duration of the created role in seconds"`
+	AttachPolicyARNs    []string          `json:"attachPolicyARNs,omitempty" description:"ARNs of existing managed policies attached to the chaos role"`
+	InlinePolicy        bool              `json:"inlinePolicy,omitempty" description:"Put the chaos policy inline in the created role"`
+}
+
+// NamingEntry is the naming of the created role and policies
+type NamingEntry struct {
+	Template string `json:"template,omitempty" description:"Template of the role and policy names with the .Prefix, .Cluster and .Namespace fields (default --name-template)"`
+	Cluster  string `json:"cluster,omitempty" description:"Name of the cluster used by the .Cluster field of the naming template (default --cluster-name)"`
+}
+
+// KubeEntry is the cluster of an entry
+type KubeEntry struct {
+	Kubeconfig string  `json:"kubeconfig,omitempty" description:"Path of the kubeconfig file"`
+	Context    string  `json:"context,omitempty" description:"Context of the kubeconfig (default the current context)"`
+	As         string  `json:"as,omitempty" description:"User or service account the requests are impersonated as"`
+	QPS        float32 `json:"qps,omitempty" description:"Maximum queries per second to the cluster"`
+	Burst      int     `json:"burst,omitempty" description:"Maximum burst of queries to the cluster"`
+}
+
+// builtinDefaults are the defaults of an entry, the same as the defaults of the flags
+func builtinDefaults() Entry {
+	return Entry{
+		Organisation: "default",
+		Infra: InfraEntry{
+			Namespace:       "hce",
+			Description:     "Infra for Harness Chaos Testing",
+			Scope:           "namespace",
+			NamespaceExists: true,
+			ServiceAccount:  "hce",
+		},
+		Environment: EnvironmentEntry{
+			Description: "Environment for Harness Chaos Testing",
+			Type:        "PreProduction",
+		},
+		Actions: "all",
+		Timeout: 180,
+		Delay:   2,
+		AWS: AWSEntry{
+			Profile:                  "default",
+			ExperimentServiceAccount: "litmus-admin",
+		},
+	}
+}
+
+// Load will read the parameters of each infra of the yaml or json config file. The file of the earlier versions,
+// a json list of the parameters, is still read with a deprecation warning.
+func Load(file string) ([]types.OnboardingParameters, error) {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Errorf("failed to read config file '%v', err: %v", file, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		log.Warnf("[Warning]: The config file '%v' is a list of parameters, which is deprecated. Use the %v %v schema instead, see the user guide", file, APIVersion, Kind)
+		var paramsSlice []types.OnboardingParameters
+		if err := json.Unmarshal(data, &paramsSlice); err != nil {
+			return nil, errors.Errorf("invalid config file '%v', err: %v", file, err)
+		}
+		return paramsSlice, nil
+	}
+
+	paramsSlice, err := parse(data)
+	if err != nil {
+		return nil, errors.Errorf("invalid config file '%v', %v", file, err)
+	}
+	return paramsSlice, nil
+}
+
+// parse will read the versioned config file: the environment variables are interpolated, then the builtin
+// defaults, the defaults of the file and each infra are merged in this order and checked strictly
+func parse(data []byte) ([]types.OnboardingParameters, error) {
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.Errorf("invalid YAML, err: %v", err)
+	}
+	var document struct {
+		APIVersion string                   `json:"apiVersion"`
+		Kind       string                   `json:"kind"`
+		Defaults   map[string]interface{}   `json:"defaults"`
+		Infras     []map[string]interface{} `json:"infras"`
+	}
+	if err := decodeStrict(jsonData, &document); err != nil {
+		return nil, err
+	}
+	if document.APIVersion != APIVersion || document.Kind != Kind {
+		return nil, errors.Errorf("unsupported apiVersion '%v' and kind '%v', expected %v %v", document.APIVersion, document.Kind, APIVersion, Kind)
+	}
+	if len(document.Infras) == 0 {
+		return nil, errors.New("no infras")
+	}
+
+	defaults, err := interpolate(document.Defaults, "defaults")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEntry(defaults, "defaults"); err != nil {
+		return nil, err
+	}
+	builtin, err := toMap(builtinDefaults())
+	if err != nil {
+		return nil, err
+	}
+	base := merge(builtin, defaults.(map[string]interface{}))
+
+	var paramsSlice []types.OnboardingParameters
+	for i, infra := range document.Infras {
+		location := "infras[" + strconv.Itoa(i) + "]"
+		value, err := interpolate(infra, location)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkEntry(value, location); err != nil {
+			return nil, err
+		}
+		merged, err := json.Marshal(merge(base, value.(map[string]interface{})))
+		if err != nil {
+			return nil, errors.Errorf("%v: %v", location, err)
+		}
+		var entry Entry
+		if err := decodeStrict(merged, &entry); err != nil {
+			return nil, errors.Errorf("%v: %v", location, err)
+		}
+		params, err := entry.params()
+		if err != nil {
+			return nil, errors.Errorf("%v: %v", location, err)
+		}
+		paramsSlice = append(paramsSlice, params)
+	}
+	return paramsSlice, nil
+}
+
+// checkEntry will check the keys and types of the entry on its own, so the errors point to where they are
+func checkEntry(value interface{}, location string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.Errorf("%v: %v", location, err)
+	}
+	var entry Entry
+	if err := decodeStrict(data, &entry); err != nil {
+		return errors.Errorf("%v: %v", location, err)
+	}
+	return nil
+}
+
+// decodeStrict will decode the json, rejecting the unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errors.Errorf("%v", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// interpolate will replace the ${NAME} references in the strings of the value with the environment variables, an
+// unset variable is an error
+func interpolate(value interface{}, location string) (interface{}, error) {
+	switch value := value.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		// The keys are sorted so the same unset variable is reported on every run
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result := map[string]interface{}{}
+		for _, key := range keys {
+			item := value[key]
+			interpolated, err := interpolate(item, location+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = interpolated
+		}
+		return result, nil
+	case []interface{}:
+		var result []interface{}
+		for i, item := range value {
+			interpolated, err := interpolate(item, location+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, interpolated)
+		}
+		return result, nil
+	case string:
+		var missing []string
+		result := envPattern.ReplaceAllStringFunc(value, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			name := envPattern.FindStringSubmatch(match)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return env
+		})
+		if len(missing) != 0 {
+			return nil, errors.Errorf("%v: unset environment variable %v", location, strings.Join(missing, ", "))
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// toMap will convert the value to its generic json form
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Errorf("failed to encode the defaults, err: %v", err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Errorf("failed to decode the defaults, err: %v", err)
+	}
+	return result, nil
+}
+
+// merge will merge the override into the base, the objects are merged key by key and any other value is replaced
+func merge(base, override map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range override {
+		baseObject, baseOK := result[key].(map[string]interface{})
+		object, ok := value.(map[string]interface{})
+		if baseOK && ok {
+			result[key] = merge(baseObject, object)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// params will convert the entry to the parameters of the onboarding
+func (e Entry) params() (types.OnboardingParameters, error) {
+
+	resources := strings.Join(e.AWS.Resources, ",")
+	if len(e.AWS.Resources) == 0 && len(e.AWS.Faults) == 0 {
+		resources = "all"
+	}
+	scopeTags, err := joinTags(e.AWS.Scope.Tags, "aws.scope.tags")
+	if err != nil {
+		return types.OnboardingParameters{}, err
+	}
+	iamTags, err := joinTags(e.AWS.IAM.Tags, "aws.iam.tags")
+	if err != nil {
+		return types.OnboardingParameters{}, err
+	}
+
+	params := types.OnboardingParameters{
+		ApiKey:       e.APIKey,
+		AccountId:    e.AccountID,
+		Organisation: e.Organisation,
+		Project:      e.Project,
+		Infra: types.InfraDetails{
+			Name:                 e.Infra.Name,
+			Namespace:            e.Infra.Namespace,
+			InfraDescription:     e.Infra.Description,
+			PlatformName:         e.Infra.PlatformName,
+			ServiceAccount:       e.Infra.ServiceAccount,
+			InfraSaExists:        e.Infra.ServiceAccountExists,
+			InfraScope:           e.Infra.Scope,
+			InfraNsExists:        e.Infra.NamespaceExists,
+			IsAutoUpgradeEnabled: e.Infra.AutoUpgrade,
+			SkipSsl:              e.Infra.SkipSSL,
+		},
+		Environment: types.EnvironmentDetails{
+			EnvironmentName:        e.Environment.Name,
+			EnvironmentDescription: e.Environment.Description,
+			EnvironmentType:        e.Environment.Type,
+		},
+		Timeout:        e.Timeout,
+		Delay:          e.Delay,
+		ProviderUrl:    e.AWS.ProviderURL,
+		Thumbprint:     e.AWS.Thumbprint,
+		CABundle:       e.AWS.CABundle,
+		EKSClusterName: e.AWS.EKSClusterName,
+		RoleName:       e.AWS.RoleName,
+		Resources:      resources,
+		Faults:         strings.Join(e.AWS.Faults, ","),
+		PolicyCatalog:  e.AWS.PolicyCatalog,
+		Scope: types.PolicyScope{
+			Tags:         scopeTags,
+			ResourceARNs: strings.Join(e.AWS.Scope.ResourceARNs, ","),
+			Regions:      strings.Join(e.AWS.Scope.Regions, ","),
+			VPCs:         strings.Join(e.AWS.Scope.VPCs, ","),
+		},
+		IAM: types.IAMOptions{
+			PermissionsBoundary: e.AWS.IAM.PermissionsBoundary,
+			Tags:                iamTags,
+			Path:                e.AWS.IAM.Path,
+			Description:         e.AWS.IAM.Description,
+			MaxSessionDuration:  e.AWS.IAM.MaxSessionDuration,
+			ManagedPolicyARNs:   strings.Join(e.AWS.IAM.AttachPolicyARNs, ","),
+			InlinePolicy:        e.AWS.IAM.InlinePolicy,
+		},
+		Naming:                       types.NamingOptions{Template: e.AWS.Naming.Template, Cluster: e.AWS.Naming.Cluster},
+		Region:                       e.AWS.Region,
+		ExperimentServiceAccountName: e.AWS.ExperimentServiceAccount,
+		KubeConfigPath:               e.Kube.Kubeconfig,
+		Kube:                         types.KubeOptions{Context: e.Kube.Context, As: e.Kube.As, QPS: e.Kube.QPS, Burst: e.Kube.Burst},
+		Actions:                      e.Actions,
+		AWSCredentialFile:            e.AWS.CredentialFile,
+		AWSProfile:                   e.AWS.Profile,
+		Dryrun:                       e.DryRun,
+		CreateNS:                     e.CreateNamespace,
+	}
+	for _, guardrail := range e.AWS.Guardrails {
+		params.Guardrails = append(params.Guardrails, types.Guardrail{
+			Name:          guardrail.Name,
+			Tags:          guardrail.Tags,
+			InstanceIDs:   guardrail.InstanceIDs,
+			DBInstanceIDs: guardrail.DBInstanceIDs,
+			Regions:       guardrail.Regions,
+			Actions:       guardrail.Actions,
+		})
+	}
+	for _, subject := range e.AWS.TrustSubjects {
+		params.TrustSubjects = append(params.TrustSubjects, types.TrustSubject{
+			ProviderUrl:    subject.ProviderURL,
+			Namespace:      subject.Namespace,
+			ServiceAccount: subject.ServiceAccount,
+		})
+	}
+	return params, nil
+}
+
+// joinTags will join the tags as the comma separated key=value pairs of the parameters
+func joinTags(tags map[string]string, location string) (string, error) {
+	var keys []string
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		if strings.ContainsAny(key, ",=") || strings.Contains(tags[key], ",") {
+			return "", errors.Errorf("invalid tag '%v' of %v, the key can't contain ',' or '=' and the value can't contain ','", key, location)
+		}
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return strings.Join(pairs, ","), nil
+}
+
+// Validate will check the parameters of each infra the way the onboarding does before anything is created, so an
+// invalid entry is reported without onboarding the others
+func Validate(paramsSlice []types.OnboardingParameters) error {
+
+	var problems []string
+	infras := map[string]int{}
+	for i, params := range paramsSlice {
+		location := "infras[" + strconv.Itoa(i) + "]"
+		if params.Infra.Name == "" {
+			problems = append(problems, location+": no infra name")
+		} else {
+			location += " '" + params.Infra.Name + "'"
+		}
+		if first, ok := infras[state.Key(params)]; ok && params.Infra.Name != "" {
+			problems = append(problems, location+": the same infra as infras["+strconv.Itoa(first)+"]")
+		} else {
+			infras[state.Key(params)] = i
+		}
+		if err := aws.ValidateIAMOptions(params.IAM); err != nil {
+			problems = append(problems, location+": "+err.Error())
+		}
+		if err := aws.ValidateNaming(params); err != nil {
+			problems = append(problems, location+": "+err.Error())
+		}
+	}
+	if len(problems) != 0 {
+		return errors.Errorf("invalid config:\n  %v", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// header is the start of every versioned config file of the tests
+const header = "apiVersion: hce.harness.io/v1\nkind: OnboardingConfig\n"
+
+func TestParse(t *testing.T) {
+
+	t.Setenv("HCE_TEST_API_KEY", "key-123")
+	t.Setenv("HCE_TEST_PROJECT", "chaos")
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+		check   func(t *testing.T, paramsSlice []types.OnboardingParameters)
+	}{
+		{
+			name: "builtin defaults",
+			config: header + `
+infras:
+  - infra:
+      name: infra-1
+`,
+			check: func(t *testing.T, paramsSlice []types.OnboardingParameters) {
+				params := paramsSlice[0]
+				if params.Infra.Namespace != "hce" || params.Infra.ServiceAccount != "hce" || params.Organisation != "default" {
+					t.Errorf("namespace, service account and organisation = %v, %v, %v, want hce, hce, default", params.Infra.Namespace, params.Infra.ServiceAccount, params.Organisation)
+				}
+				if !params.Infra.InfraNsExists {
+					t.Errorf("namespaceExists = false, want the builtin true")
+				}
+				if params.Resources != "all" || params.Timeout != 180 || params.Delay != 2 {
+					t.Errorf("resources, timeout and delay = %v, %v, %v, want all, 180, 2", params.Resources, params.Timeout, params.Delay)
+				}
+				if params.Naming.Template != "" {
+					t.Errorf("naming template = %v, want it unset so the flag applies", params.Naming.Template)
+				}
+			},
+		},
+		{
+			name: "defaults of the file are merged key by key",
+			config: header + `
+defaults:
+  project: shared
+  infra:
+    namespace: chaos
+  aws:
+    region: us-east-1
+    iam:
+      tags:
+        team: sre
+infras:
+  - infra:
+      name: infra-1
+  - project: own
+    infra:
+      name: infra-2
+      namespace: other
+    aws:
+      iam:
+        path: /chaos/
+`,
+			check: func(t *testing.T, paramsSlice []types.OnboardingParameters) {
+				first, second := paramsSlice[0], paramsSlice[1]
+				if first.Project != "shared" || first.Infra.Namespace != "chaos" || first.Infra.ServiceAccount != "hce" {
+					t.Errorf("infras[0] project, namespace and service account = %v, %v, %v, want shared, chaos, hce", first.Project, first.Infra.Namespace, first.Infra.ServiceAccount)
+				}
+				if second.Project != "own" || second.Infra.Namespace != "other" || second.Region != "us-east-1" {
+					t.Errorf("infras[1] project, namespace and region = %v, %v, %v, want own, other, us-east-1", second.Project, second.Infra.Namespace, second.Region)
+				}
+				if second.IAM.Tags != "team=sre" || second.IAM.Path != "/chaos/" {
+					t.Errorf("infras[1] iam tags and path = %v, %v, want team=sre, /chaos/", second.IAM.Tags, second.IAM.Path)
+				}
+			},
+		},
+		{
+			name: "false overrides a builtin true",
+			config: header + `
+defaults:
+  infra:
+    namespaceExists: false
+infras:
+  - infra:
+      name: infra-1
+  - infra:
+      name: infra-2
+      namespaceExists: true
+`,
+			check: func(t *testing.T, paramsSlice []types.OnboardingParameters) {
+				if paramsSlice[0].Infra.InfraNsExists {
+					t.Errorf("infras[0] namespaceExists = true, want false of the defaults")
+				}
+				if !paramsSlice[1].Infra.InfraNsExists {
+					t.Errorf("infras[1] namespaceExists = false, want true of the infra")
+				}
+			},
+		},
+		{
+			name: "faults without resources don't grant all",
+			config: header + `
+infras:
+  - infra:
+      name: infra-1
+    aws:
+      faults: [ec2-stop-by-id, rds-instance-reboot]
+`,
+			check: func(t *testing.T, paramsSlice []types.OnboardingParameters) {
+				if paramsSlice[0].Resources != "" || paramsSlice[0].Faults != "ec2-stop-by-id,rds-instance-reboot" {
+					t.Errorf("resources and faults = %q, %q", paramsSlice[0].Resources, paramsSlice[0].Faults)
+				}
+			},
+		},
+		{
+			name: "environment variables and the escape",
+			config: header + `
+defaults:
+  apiKey: ${HCE_TEST_API_KEY}
+infras:
+  - project: ${HCE_TEST_PROJECT}-${HCE_TEST_PROJECT}
+    infra:
+      name: infra-1
+      description: literal $${HCE_TEST_PROJECT} and $$ kept
+`,
+			check: func(t *testing.T, paramsSlice []types.OnboardingParameters) {
+				params := paramsSlice[0]
+				if params.ApiKey != "key-123" || params.Project != "chaos-chaos" {
+					t.Errorf("apiKey and project = %v, %v, want key-123, chaos-chaos", params.ApiKey, params.Project)
+				}
+				if want := "literal ${HCE_TEST_PROJECT} and $$ kept"; params.Infra.InfraDescription != want {
+					t.Errorf("description = %q, want %q", params.Infra.InfraDescription, want)
+				}
+			},
+		},
+		{
+			name: "unset environment variable",
+			config: header + `
+infras:
+  - infra:
+      name: infra-1
+  - infra:
+      name: infra-2
+    aws:
+      resources: [ec2, "${HCE_TEST_UNSET_VARIABLE}"]
+`,
+			wantErr: "infras[1].aws.resources[1]: unset environment variable HCE_TEST_UNSET_VARIABLE",
+		},
+		{
+			name: "unknown field of an infra",
+			config: header + `
+infras:
+  - infra:
+      name: infra-1
+  - infra:
+      name: infra-2
+      namspace: chaos
+`,
+			wantErr: `infras[1]: unknown field "namspace"`,
+		},
+		{
+			name: "unknown field of the defaults",
+			config: header + `
+defaults:
+  aws:
+    regoin: us-east-1
+infras:
+  - infra:
+      name: infra-1
+`,
+			wantErr: `defaults: unknown field "regoin"`,
+		},
+		{
+			name: "unknown field of the document",
+			config: header + `
+infra:
+  name: infra-1
+infras:
+  - infra:
+      name: infra-1
+`,
+			wantErr: `unknown field "infra"`,
+		},
+		{
+			name: "wrong type of a field",
+			config: header + `
+infras:
+  - infra:
+      name: infra-1
+    timeout: soon
+`,
+			wantErr: "infras[0]: cannot unmarshal string into Go struct field Entry.timeout of type int",
+		},
+		{
+			name:    "unsupported version",
+			config:  "apiVersion: hce.harness.io/v2\nkind: OnboardingConfig\ninfras: [{}]\n",
+			wantErr: "unsupported apiVersion 'hce.harness.io/v2'",
+		},
+		{
+			name:    "no infras",
+			config:  header + "infras: []\n",
+			wantErr: "no infras",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paramsSlice, err := parse([]byte(tt.config))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parse() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() unexpected err: %v", err)
+			}
+			tt.check(t, paramsSlice)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name:      "versioned yaml file",
+			file:      write("config.yaml", header+"infras:\n  - infra:\n      name: infra-1\n  - infra:\n      name: infra-2\n"),
+			wantNames: []string{"infra-1", "infra-2"},
+		},
+		{
+			name:      "legacy list of parameters",
+			file:      write("legacy.json", `  [{"ApiKey": "key", "Infra": {"Name": "infra-1", "Namespace": "hce"}}, {"Infra": {"Name": "infra-2"}}]`),
+			wantNames: []string{"infra-1", "infra-2"},
+		},
+		{
+			name:    "invalid legacy list",
+			file:    write("broken.json", `[{"Infra": "infra-1"}]`),
+			wantErr: "invalid config file",
+		},
+		{
+			name:    "errors name the file",
+			file:    write("unknown.yaml", header+"infras:\n  - infra:\n      nam: infra-1\n"),
+			wantErr: "invalid config file '" + filepath.Join(dir, "unknown.yaml") + `', infras[0]: unknown field "nam"`,
+		},
+		{
+			name:    "missing file",
+			file:    filepath.Join(dir, "missing.yaml"),
+			wantErr: "failed to read config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paramsSlice, err := Load(tt.file)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected err: %v", err)
+			}
+			var names []string
+			for _, params := range paramsSlice {
+				names = append(names, params.Infra.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("Load() infras = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
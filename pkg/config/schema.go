@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema will return the JSON Schema of the versioned config file, generated from the Document type, for the
+// completion and validation of the editors
+func Schema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Document{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "onboard_hce_aws " + Kind
+	schema["required"] = []string{"apiVersion", "kind", "infras"}
+	return schema
+}
+
+// typeSchema will return the schema of the go type, the fields of a struct are its properties and no other property
+// is allowed
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	}
+
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		property := typeSchema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
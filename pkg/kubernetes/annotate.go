@@ -2,26 +2,24 @@ package kubernetes
 
 import (
 	"context"
-	"strings"
 
+	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/aws"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // AnnotateServiceAccount will annotate the given experiment service account with aws roleARN
 func AnnotateServiceAccount(params types.OnboardingParameters, clients clients.ClientSets) error {
 
-	var roleName string
-	if strings.TrimSpace(params.RoleName) == "" {
-		roleName = "HCERole-" + params.Infra.Namespace
-	} else {
-		roleName = params.RoleName
+	roleName, err := aws.ChaosRoleName(params)
+	if err != nil {
+		return err
 	}
-
-	roleARN, err := aws.GetRoleARN(params.Region, roleName)
+	roleARN, err := aws.GetRoleARN(params, roleName)
 	if err != nil {
 		return errors.Errorf("failed to retrive roleARN from given role name '%v', err: %v", roleName, err)
 	}
@@ -34,7 +32,7 @@ func AnnotateServiceAccount(params types.OnboardingParameters, clients clients.C
 		sa.Annotations = make(map[string]string)
 	}
 
-	sa.Annotations["eks.amazonaws.com/role-arn"] = roleARN
+	sa.Annotations[types.RoleARNAnnotation] = roleARN
 
 	_, err = clients.KubeClient.CoreV1().ServiceAccounts(params.Infra.Namespace).Update(context.Background(), sa, metav1.UpdateOptions{})
 	if err != nil {
@@ -42,3 +40,44 @@ func AnnotateServiceAccount(params types.OnboardingParameters, clients clients.C
 	}
 	return nil
 }
+
+// RemoveServiceAccountAnnotation will remove the aws roleARN annotation from the experiment service account
+// only when it points to the given roleARN
+func RemoveServiceAccountAnnotation(roleARN string, params types.OnboardingParameters, clients clients.ClientSets) error {
+
+	sa, err := clients.KubeClient.CoreV1().ServiceAccounts(params.Infra.Namespace).Get(context.Background(), params.ExperimentServiceAccountName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.Infof("[Info]: The service account '%v' is already deleted", params.ExperimentServiceAccountName)
+			return nil
+		}
+		return err
+	}
+
+	value, ok := sa.Annotations[types.RoleARNAnnotation]
+	if !ok {
+		return nil
+	}
+	if value != roleARN {
+		log.Warnf("[Warning]: Skipping the removal of '%v' annotation as it points to '%v'", types.RoleARNAnnotation, value)
+		return nil
+	}
+
+	delete(sa.Annotations, types.RoleARNAnnotation)
+	_, err = clients.KubeClient.CoreV1().ServiceAccounts(params.Infra.Namespace).Update(context.Background(), sa, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	log.Infof("[Info]: The '%v' annotation is removed from service account '%v'", types.RoleARNAnnotation, params.ExperimentServiceAccountName)
+	return nil
+}
+
+// GetRoleAnnotation will return the current aws roleARN annotation of the experiment service account
+func GetRoleAnnotation(params types.OnboardingParameters, clients clients.ClientSets) (string, error) {
+
+	sa, err := clients.KubeClient.CoreV1().ServiceAccounts(params.Infra.Namespace).Get(context.Background(), params.ExperimentServiceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return sa.Annotations[types.RoleARNAnnotation], nil
+}
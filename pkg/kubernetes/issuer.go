@@ -0,0 +1,29 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+)
+
+// ClusterIssuer will return the issuer of the service account tokens, read from the OIDC discovery document served
+// by the api server of the cluster
+func ClusterIssuer(clients clients.ClientSets) (string, error) {
+
+	data, err := clients.KubeClient.Discovery().RESTClient().Get().AbsPath("/.well-known/openid-configuration").DoRaw(context.TODO())
+	if err != nil {
+		return "", errors.Errorf("failed to get the OIDC discovery document of the cluster, err: %v", err)
+	}
+	var configuration struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := json.Unmarshal(data, &configuration); err != nil {
+		return "", errors.Errorf("failed to parse the OIDC discovery document of the cluster, err: %v", err)
+	}
+	if configuration.Issuer == "" {
+		return "", errors.New("the OIDC discovery document of the cluster has no issuer")
+	}
+	return configuration.Issuer, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/litmuschaos/litmus-go/pkg/log"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,3 +31,16 @@ func CreateNS(namespaceName string, clients clients.ClientSets) error {
 
 	return nil
 }
+
+// NamespaceExists will check if the given namespace exists
+func NamespaceExists(namespaceName string, clients clients.ClientSets) (bool, error) {
+
+	_, err := clients.KubeClient.CoreV1().Namespaces().Get(context.TODO(), namespaceName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodStatus is the readiness of a single pod of the chaos infra
+type PodStatus struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+	Ready bool   `json:"ready"`
+}
+
+// WorkloadStatus is the readiness of a deployment of the chaos infra and its pods
+type WorkloadStatus struct {
+	Name   string      `json:"name"`
+	Found  bool        `json:"found"`
+	Ready  int32       `json:"ready"`
+	Wanted int32       `json:"wanted"`
+	Pods   []PodStatus `json:"pods,omitempty"`
+}
+
+// GetWorkloadStatus will return the readiness of the deployments among the given chaos infra objects
+func GetWorkloadStatus(objects []types.AppliedObject, clients clients.ClientSets) ([]WorkloadStatus, error) {
+
+	var result []WorkloadStatus
+	for _, obj := range objects {
+		if obj.Kind != "Deployment" {
+			continue
+		}
+		status := WorkloadStatus{Name: obj.Name}
+
+		deployment, err := clients.KubeClient.AppsV1().Deployments(obj.Namespace).Get(context.Background(), obj.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				result = append(result, status)
+				continue
+			}
+			return nil, errors.Errorf("failed to get deployment '%v', err: %v", obj.Name, err)
+		}
+		status.Found = true
+		status.Ready = deployment.Status.ReadyReplicas
+		if deployment.Spec.Replicas != nil {
+			status.Wanted = *deployment.Spec.Replicas
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		if err != nil {
+			return nil, errors.Errorf("failed to parse the selector of deployment '%v', err: %v", obj.Name, err)
+		}
+		pods, err := clients.KubeClient.CoreV1().Pods(obj.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, errors.Errorf("failed to list the pods of deployment '%v', err: %v", obj.Name, err)
+		}
+		for _, pod := range pods.Items {
+			status.Pods = append(status.Pods, PodStatus{
+				Name:  pod.Name,
+				Phase: string(pod.Status.Phase),
+				Ready: isPodReady(pod),
+			})
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// isPodReady will check the Ready condition of the pod
+func isPodReady(pod v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package register
+
+import (
+	"bytes"
+	ejson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// identifiers will return the harness scope identifiers for the graphql queries
+func identifiers(params types.OnboardingParameters) map[string]string {
+	return map[string]string{
+		"orgIdentifier":     params.Organisation,
+		"accountIdentifier": params.AccountId,
+		"projectIdentifier": params.Project,
+	}
+}
+
+// queryChaosManager will run the given graphql query against the chaos manager and decode the response into result
+func queryChaosManager(query string, variables map[string]interface{}, params types.OnboardingParameters, result interface{}) error {
+
+	url := fmt.Sprintf("https://app.harness.io/gateway/chaos/manager/api/query?accountIdentifier=%s", params.AccountId)
+
+	body, err := ejson.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return errors.Errorf("error creating request body: %v", err)
+	}
+
+	var graphqlErrors struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	data, err := sendHarnessRequest("POST", url, body, params)
+	if err != nil {
+		return err
+	}
+	if err := ejson.Unmarshal(data, &graphqlErrors); err == nil && len(graphqlErrors.Errors) != 0 {
+		return errors.Errorf("graphql query failed, err: %v", graphqlErrors.Errors[0].Message)
+	}
+	if err := ejson.Unmarshal(data, result); err != nil {
+		return errors.Errorf("error parsing JSON response: %v", err)
+	}
+	return nil
+}
+
+// doHarnessRequest will send a request to the harness rest api and decode the response into result, if provided
+func doHarnessRequest(method, url string, body []byte, params types.OnboardingParameters, result interface{}) error {
+
+	data, err := sendHarnessRequest(method, url, body, params)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if err := ejson.Unmarshal(data, result); err != nil {
+		return errors.Errorf("error parsing JSON response: %v", err)
+	}
+	return nil
+}
+
+// sendHarnessRequest will send an authenticated request to harness and return the response body
+func sendHarnessRequest(method, url string, body []byte, params types.OnboardingParameters) ([]byte, error) {
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, errors.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", params.ApiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Errorf("error on response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Errorf("error reading response data: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("status code '%v', response body: '%s'", resp.StatusCode, string(data))
+	}
+	return data, nil
+}
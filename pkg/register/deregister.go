@@ -0,0 +1,211 @@
+package register
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/litmuschaos/litmus-go/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GetInfraID will return the ID of the chaos infra with the given name
+func GetInfraID(params types.OnboardingParameters) (string, error) {
+
+	query := `query ListInfras($identifiers: IdentifiersRequest!, $request: ListInfraRequest) {
+		listInfras(identifiers: $identifiers, request: $request) {
+			infras {
+				infraID
+				name
+			}
+		}
+	}`
+	variables := map[string]interface{}{
+		"identifiers": identifiers(params),
+		"request": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"name": params.Infra.Name,
+			},
+		},
+	}
+
+	var responseData struct {
+		Data struct {
+			ListInfras struct {
+				Infras []struct {
+					InfraID string `json:"infraID"`
+					Name    string `json:"name"`
+				} `json:"infras"`
+			} `json:"listInfras"`
+		} `json:"data"`
+	}
+	if err := queryChaosManager(query, variables, params, &responseData); err != nil {
+		return "", err
+	}
+
+	// The name filter is a partial match, so look for the exact name
+	for _, infra := range responseData.Data.ListInfras.Infras {
+		if infra.Name == params.Infra.Name {
+			return infra.InfraID, nil
+		}
+	}
+	return "", errors.Errorf("no chaos infra found with name '%v'", params.Infra.Name)
+}
+
+// DeleteChaosManifest will delete the chaos infra objects recorded as applied by this cli, in the reverse order of
+// their creation
+func DeleteChaosManifest(infraID string, objects []types.AppliedObject, clients clients.ClientSets) error {
+
+	log.Info("[Info]: Deleting the chaos infra manifest from the cluster")
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		gvr := schema.GroupVersionResource{Group: obj.Group, Version: obj.Version, Resource: obj.Resource}
+		resourceClient := clients.DynamicClient.Resource(gvr).Namespace(obj.Namespace)
+
+		existing, err := resourceClient.Get(context.TODO(), obj.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				log.Infof("[Info]: %v '%v' is already deleted", obj.Kind, obj.Name)
+				continue
+			}
+			return errors.Errorf("failed to get %v '%v', err: %v", obj.Kind, obj.Name, err)
+		}
+
+		// Only delete the objects which carry the labels added while registering this infra
+		labels := existing.GetLabels()
+		if labels[types.ManagedByKey] != types.ManagedByValue || labels[types.InfraIDLabel] != infraID {
+			log.Warnf("[Warning]: Skipping %v '%v' as it was not created by this cli for infra '%v'", obj.Kind, obj.Name, infraID)
+			continue
+		}
+
+		if err := resourceClient.Delete(context.TODO(), obj.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return errors.Errorf("failed to delete %v '%v', err: %v", obj.Kind, obj.Name, err)
+		}
+		log.Infof("[Info]: Deleted %v '%v'", obj.Kind, obj.Name)
+	}
+	return nil
+}
+
+// IsManagedInfra will check that the chaos infra was registered by this cli, through the tag added while registering
+func IsManagedInfra(infraID string, params types.OnboardingParameters) (bool, error) {
+	infra, err := GetChaosInfra(infraID, params)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range infra.Tags {
+		if tag == types.ManagedInfraTag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteInfra will remove the chaos infra from harness
+func DeleteInfra(infraID string, params types.OnboardingParameters) error {
+
+	query := `mutation DeleteInfra($identifiers: IdentifiersRequest!, $infraID: String!) {
+		deleteInfra(identifiers: $identifiers, infraID: $infraID)
+	}`
+	variables := map[string]interface{}{
+		"identifiers": identifiers(params),
+		"infraID":     infraID,
+	}
+
+	var responseData struct {
+		Data struct {
+			DeleteInfra string `json:"deleteInfra"`
+		} `json:"data"`
+	}
+	if err := queryChaosManager(query, variables, params, &responseData); err != nil {
+		return err
+	}
+	log.Infof("[Info]: The chaos infra '%v' is removed from harness", infraID)
+	return nil
+}
+
+// environmentInfras will return the IDs of the chaos infras of the environment which are not removed
+func environmentInfras(envID string, params types.OnboardingParameters) ([]string, error) {
+
+	query := `query ListInfras($identifiers: IdentifiersRequest!, $request: ListInfraRequest) {
+		listInfras(identifiers: $identifiers, request: $request) {
+			infras {
+				infraID
+				isRemoved
+			}
+		}
+	}`
+	variables := map[string]interface{}{
+		"identifiers": identifiers(params),
+		"request": map[string]interface{}{
+			"environmentIDs": []string{envID},
+		},
+	}
+
+	var responseData struct {
+		Data struct {
+			ListInfras struct {
+				Infras []struct {
+					InfraID   string `json:"infraID"`
+					IsRemoved bool   `json:"isRemoved"`
+				} `json:"infras"`
+			} `json:"listInfras"`
+		} `json:"data"`
+	}
+	if err := queryChaosManager(query, variables, params, &responseData); err != nil {
+		return nil, err
+	}
+
+	var infraIDs []string
+	for _, infra := range responseData.Data.ListInfras.Infras {
+		if !infra.IsRemoved {
+			infraIDs = append(infraIDs, infra.InfraID)
+		}
+	}
+	return infraIDs, nil
+}
+
+// DeleteChaosEnvironment will delete the chaos environment if it was created by this cli and no chaos infra other
+// than the given one is left in it
+func DeleteChaosEnvironment(infraID string, params types.OnboardingParameters) error {
+
+	if params.Environment.EnvironmentName == "" {
+		params.Environment.EnvironmentName = params.Infra.Name + "-env"
+	}
+	envID := convertString(params.Environment.EnvironmentName)
+	url := fmt.Sprintf("https://app.harness.io/ng/api/environmentsV2/%s?accountIdentifier=%s&orgIdentifier=%s&projectIdentifier=%s",
+		envID, params.AccountId, params.Organisation, params.Project)
+
+	// Fetch the environment to verify the ownership
+	var envResponse struct {
+		Data struct {
+			Environment types.HarnessEnvironment `json:"environment"`
+		} `json:"data"`
+	}
+	if err := doHarnessRequest("GET", url, nil, params, &envResponse); err != nil {
+		return errors.Errorf("failed to get chaos environment '%v', err: %v", envID, err)
+	}
+	if envResponse.Data.Environment.Tags[types.ManagedByKey] != types.ManagedByValue {
+		log.Warnf("[Warning]: Skipping the deletion of environment '%v' as it was not created by this cli", envID)
+		return nil
+	}
+	infraIDs, err := environmentInfras(envID, params)
+	if err != nil {
+		return errors.Errorf("failed to list the chaos infras of environment '%v', err: %v", envID, err)
+	}
+	for _, id := range infraIDs {
+		if id != infraID {
+			log.Warnf("[Warning]: Skipping the deletion of environment '%v' as the chaos infra '%v' is still registered in it", envID, id)
+			return nil
+		}
+	}
+
+	if err := doHarnessRequest("DELETE", url, nil, params, nil); err != nil {
+		return errors.Errorf("failed to delete chaos environment '%v', err: %v", envID, err)
+	}
+	log.Infof("[Info]: The chaos environment '%v' is deleted", envID)
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/clients"
 	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -25,8 +26,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer/recognizer"
 )
 
-// RegisterInfra is a function to register infrastructure details using the Harness API.
-func RegisterInfra(params types.OnboardingParameters) error {
+// CreateEnvironment will create the chaos environment for the infra, an existing environment is reused.
+// It returns the environment identifier.
+func CreateEnvironment(params types.OnboardingParameters) (string, error) {
 
 	// If the user didn't provide infra-environment-id, then set it to infra-name with a '-env' suffix.
 	if params.Environment.EnvironmentName == "" {
@@ -36,10 +38,21 @@ func RegisterInfra(params types.OnboardingParameters) error {
 	// createChaosEnvironment will create the chaos infra for the environment
 	if err := createChaosEnvironment(params); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
-			return errors.Errorf("failed to create chaos environment '%v', err: %v", params.Environment.EnvironmentName, err)
+			return "", errors.Errorf("failed to create chaos environment '%v', err: %v", params.Environment.EnvironmentName, err)
 		}
 		log.Info("[Info]: Environment already exits, creating chaos infra")
 	}
+	return convertString(params.Environment.EnvironmentName), nil
+}
+
+// RegisterInfra is a function to register infrastructure details using the Harness API.
+// It returns the infraID and the manifest of the registered infra.
+func RegisterInfra(params types.OnboardingParameters) (string, string, error) {
+
+	// If the user didn't provide infra-environment-id, then set it to infra-name with a '-env' suffix.
+	if params.Environment.EnvironmentName == "" {
+		params.Environment.EnvironmentName = params.Infra.Name + "-env"
+	}
 
 	// The API endpoint URL
 	url := fmt.Sprintf("https://app.harness.io/gateway/chaos/manager/api/query?accountIdentifier=%s", params.AccountId)
@@ -83,27 +96,7 @@ func RegisterInfra(params types.OnboardingParameters) error {
 	})
 
 	// Set up the request variables
-	variables := types.Variables{
-		Identifiers: types.Identifiers{
-			OrgIdentifier:     params.Organisation,
-			AccountIdentifier: params.AccountId,
-			ProjectIdentifier: params.Project,
-		},
-		Request: types.Request{
-			Name:                 params.Infra.Name,
-			EnvironmentID:        convertString(params.Environment.EnvironmentName),
-			Description:          params.Infra.InfraDescription,
-			PlatformName:         params.Infra.PlatformName,
-			InfraNamespace:       params.Infra.Namespace,
-			ServiceAccount:       params.Infra.ServiceAccount,
-			InfraScope:           params.Infra.InfraScope,
-			InfraNsExists:        params.Infra.InfraNsExists,
-			InfraSaExists:        params.Infra.InfraSaExists,
-			InstallationType:     "MANIFEST",
-			SkipSsl:              params.Infra.SkipSsl,
-			IsAutoUpgradeEnabled: params.Infra.IsAutoUpgradeEnabled,
-		},
-	}
+	variables := InfraRequest(params)
 
 	// Create the payload for the API call
 	payload := types.Payload{
@@ -114,13 +107,13 @@ func RegisterInfra(params types.OnboardingParameters) error {
 	// Serialize the payload to JSON
 	body, err := ejson.Marshal(payload)
 	if err != nil {
-		return errors.Errorf("Error serializing payload to JSON: %v", err)
+		return "", "", errors.Errorf("Error serializing payload to JSON: %v", err)
 	}
 
 	// Create a new HTTP POST request
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return errors.Errorf("Error creating request: %v", err)
+		return "", "", errors.Errorf("Error creating request: %v", err)
 	}
 
 	// Set the required headers
@@ -132,7 +125,7 @@ func RegisterInfra(params types.OnboardingParameters) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return errors.Errorf("Error on response: %v", err)
+		return "", "", errors.Errorf("Error on response: %v", err)
 
 	}
 	defer resp.Body.Close()
@@ -140,40 +133,77 @@ func RegisterInfra(params types.OnboardingParameters) error {
 	// Read the response data
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return errors.Errorf("Error reading response data: %v", err)
+		return "", "", errors.Errorf("Error reading response data: %v", err)
 	}
 
 	// Parse the response data into the Response struct
 	var responseData types.Response
 	err = ejson.Unmarshal(data, &responseData)
 	if err != nil {
-		return errors.Errorf("Error parsing JSON response: %v", err)
+		return "", "", errors.Errorf("Error parsing JSON response: %v", err)
 	}
 
 	if responseData.Data.RegisterInfra.Manifest != "" {
 		log.Info("[Info]: Chaos Infra Manifest prepared")
 	} else {
-		return errors.Errorf("[Info]: The prepared chaos infra manifest is empty")
+		return "", "", errors.Errorf("[Info]: The prepared chaos infra manifest is empty")
 	}
 	log.Infof("[Info]: The infraId is: %v", responseData.Data.RegisterInfra.InfraID)
+	return responseData.Data.RegisterInfra.InfraID, responseData.Data.RegisterInfra.Manifest, nil
+}
+
+// ApplyChaosManifest will create the chaosYAML manifest created while registring infra.
+// It returns the objects applied so far, even on failure. The objects which already
+// exist for the same infra are considered applied, so that it can be re-run.
+func ApplyChaosManifest(manifest, infraID string, params types.OnboardingParameters, clients clients.ClientSets) ([]types.AppliedObject, error) {
+
+	// Get the dynamic client for unstructured objects
+	dynamicClient := clients.DynamicClient
 
-	if err := applyChaosManifest(responseData.Data.RegisterInfra.Token, responseData.Data.RegisterInfra.Manifest, responseData.Data.RegisterInfra.InfraID, params); err != nil {
-		return errors.Errorf("Failed to create chaos infra manifest: ", err)
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-// applyChaosManifest will create the chaosYAML manifest created while registring infra
-func applyChaosManifest(token, manifest, infraID string, params types.OnboardingParameters) error {
-	clients := clients.ClientSets{}
+	var applied []types.AppliedObject
+	log.Info("[Info]: Creating the manifest to install chaos infra")
+	for _, obj := range objects {
+		// Mark the object so that it can be identified during deregister
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[types.ManagedByKey] = types.ManagedByValue
+		labels[types.InfraIDLabel] = infraID
+		obj.SetLabels(labels)
 
-	//Getting kubeConfig and Generate ClientSets
-	if err := clients.GenerateClientSetFromKubeConfig(); err != nil {
-		return fmt.Errorf("Unable to Get the kubeconfig, err: %v", err)
+		// Get the GVR from the object to create a dynamic client for that GVR
+		gvk := obj.GroupVersionKind()
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		appliedObject := toAppliedObject(obj, params.Infra.Namespace)
+
+		// Create the object using the dynamic client
+		resourceClient := dynamicClient.Resource(gvr).Namespace(params.Infra.Namespace)
+		_, err := resourceClient.Create(context.TODO(), obj, metav1.CreateOptions{})
+		if err != nil {
+			if !k8serrors.IsAlreadyExists(err) {
+				return applied, fmt.Errorf("Error applying manifest: %v", err)
+			}
+			existing, getErr := resourceClient.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+			if getErr != nil || existing.GetLabels()[types.InfraIDLabel] != infraID {
+				return applied, fmt.Errorf("Error applying manifest: %v", err)
+			}
+			log.Infof("[Info]: %v '%v' is already applied", gvk.Kind, obj.GetName())
+		}
+		applied = append(applied, appliedObject)
 	}
 
-	// Get the dynamic client for unstructured objects
-	dynamicClient := clients.DynamicClient
+	log.Info("[Info]: Successfully applied chaos infra manifest to Kubernetes cluster")
+	return applied, nil
+}
+
+// decodeManifest will split the chaos infra manifest into individual unstructured objects
+func decodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
 
 	// Remove first line of the manifest if it contains '---'
 	if strings.HasPrefix(manifest, "---") {
@@ -185,48 +215,68 @@ func applyChaosManifest(token, manifest, infraID string, params types.Onboarding
 		}
 	}
 
-	// Split the manifest into individual resources
-	manifests := strings.Split(manifest, "---")
+	// Create a new scheme
+	s := runtime.NewScheme()
 
-	log.Info("[Info]: Creating the manifest to install chaos infra")
-	for _, m := range manifests {
-		// Decode the YAML manifest into an unstructured object
-		obj := &unstructured.Unstructured{}
-
-		// Create a new scheme
-		s := runtime.NewScheme()
-
-		// Create the recogniser decoder
-		d := recognizer.NewDecoder(
-			json.NewSerializer(json.DefaultMetaFactory, s, s, false),
-			json.NewYAMLSerializer(json.DefaultMetaFactory, s, s),
-		)
+	// Create the recogniser decoder
+	d := recognizer.NewDecoder(
+		json.NewSerializer(json.DefaultMetaFactory, s, s, false),
+		json.NewYAMLSerializer(json.DefaultMetaFactory, s, s),
+	)
 
+	var objects []*unstructured.Unstructured
+	// Split the manifest into individual resources
+	for _, m := range strings.Split(manifest, "---") {
+		if strings.TrimSpace(m) == "" {
+			continue
+		}
 		// Decode YAML to unstructured object
+		obj := &unstructured.Unstructured{}
 		if _, _, err := d.Decode([]byte(m), nil, obj); err != nil {
-			return fmt.Errorf("Error decoding manifest: %v", err)
+			return nil, fmt.Errorf("Error decoding manifest: %v", err)
 		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
 
-		// Get the GVR from the object to create a dynamic client for that GVR
-		gvk := obj.GroupVersionKind()
-		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+// GetInfraManifest will fetch the manifest of an already registered chaos infra
+func GetInfraManifest(infraID string, params types.OnboardingParameters) (string, error) {
 
-		// Create the object using the dynamic client
-		_, err := dynamicClient.Resource(gvr).Namespace(params.Infra.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
-		if err != nil {
-			return fmt.Errorf("Error applying manifest: %v", err)
-		}
+	query := `query GetInfraManifest($infraID: ID!, $upgrade: Boolean!, $identifiers: IdentifiersRequest!) {
+		getInfraManifest(infraID: $infraID, upgrade: $upgrade, identifiers: $identifiers)
+	}`
+	variables := map[string]interface{}{
+		"identifiers": identifiers(params),
+		"infraID":     infraID,
+		"upgrade":     false,
 	}
 
-	log.Info("[Info]: Successfully applied chaos infra manifest to Kubernetes cluster")
-	if err := waitForChaosInfra(infraID, params); err != nil {
-		return errors.Errorf("failed to get the chaos infra in Connected state, err: $v", err)
+	var responseData struct {
+		Data struct {
+			GetInfraManifest string `json:"getInfraManifest"`
+		} `json:"data"`
 	}
-	return nil
+	if err := queryChaosManager(query, variables, params, &responseData); err != nil {
+		return "", err
+	}
+	if responseData.Data.GetInfraManifest == "" {
+		return "", errors.Errorf("the manifest for chaos infra '%v' is empty", infraID)
+	}
+	return responseData.Data.GetInfraManifest, nil
 }
 
 // getChaosInfraState fetches the current state of the chaos infrastructure
 func getChaosInfraState(infraID string, params types.OnboardingParameters) (bool, error) {
+	infra, err := GetChaosInfra(infraID, params)
+	if err != nil {
+		return false, err
+	}
+	return infra.IsActive, nil
+}
+
+// GetChaosInfra fetches the details of the chaos infrastructure from harness
+func GetChaosInfra(infraID string, params types.OnboardingParameters) (types.ChaosInfra, error) {
 
 	// The API endpoint URL
 	url := fmt.Sprintf("https://app.harness.io/gateway/chaos/manager/api/query?accountIdentifier=%s", params.AccountId)
@@ -286,13 +336,13 @@ func getChaosInfraState(infraID string, params types.OnboardingParameters) (bool
 	}
 	reqBodyBytes, err := ejson.Marshal(reqBody)
 	if err != nil {
-		return false, errors.Errorf("error creating request body: %v", err)
+		return types.ChaosInfra{}, errors.Errorf("error creating request body: %v", err)
 	}
 
 	// Create a new HTTP POST request
 	req, err := http.NewRequest("POST", url, strings.NewReader(string(reqBodyBytes)))
 	if err != nil {
-		return false, errors.Errorf("error creating request: %v", err)
+		return types.ChaosInfra{}, errors.Errorf("error creating request: %v", err)
 	}
 
 	// Set the required headers
@@ -303,42 +353,42 @@ func getChaosInfraState(infraID string, params types.OnboardingParameters) (bool
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, errors.Errorf("error on response: %v", err)
+		return types.ChaosInfra{}, errors.Errorf("error on response: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response data
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return false, errors.Errorf("error reading response data: %v", err)
+		return types.ChaosInfra{}, errors.Errorf("error reading response data: %v", err)
 	}
 
 	// Parse the response data into the Response struct
 	var responseData struct {
 		Data struct {
-			GetInfra struct {
-				IsActive bool `json:"isActive"`
-			} `json:"getInfra"`
+			GetInfra types.ChaosInfra `json:"getInfra"`
 		} `json:"data"`
 	}
 
 	err = ejson.Unmarshal(data, &responseData)
 	if err != nil {
-		return false, errors.Errorf("error parsing JSON response: %v", err)
+		return types.ChaosInfra{}, errors.Errorf("error parsing JSON response: %v", err)
 	}
-	return responseData.Data.GetInfra.IsActive, nil
+	return responseData.Data.GetInfra, nil
 }
 
-// waitForChaosInfra will wait for the chaos infra to get in active state for the given timeout.
-func waitForChaosInfra(infraID string, params types.OnboardingParameters) error {
-	timeout := time.After(180 * time.Second)
-	ticker := time.NewTicker(2 * time.Second)
+// WaitForChaosInfra will wait for the chaos infra to get in active state for the timeout of the params, checking its
+// state after every delay of the params
+func WaitForChaosInfra(infraID string, params types.OnboardingParameters) error {
+	timeout, delay := WaitSettings(params)
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	ticker := time.NewTicker(time.Duration(delay) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-timeout:
-			return errors.New("timeout reached while waiting for infra")
+		case <-deadline:
+			return errors.Errorf("timeout reached while waiting for infra, it is not active after %vs", timeout)
 		case <-ticker.C:
 			result, err := getChaosInfraState(infraID, params)
 			if err != nil {
@@ -353,17 +403,102 @@ func waitForChaosInfra(infraID string, params types.OnboardingParameters) error
 	}
 }
 
-// createChaosEnvironment will create the chaos environment for chaos infra
-func createChaosEnvironment(params types.OnboardingParameters) error {
+// WaitSettings will return the timeout and the delay in seconds of the wait for the chaos infra, the unset values
+// default to the ones of the flags
+func WaitSettings(params types.OnboardingParameters) (int, int) {
+	timeout, delay := params.Timeout, params.Delay
+	if timeout <= 0 {
+		timeout = 180
+	}
+	if delay <= 0 {
+		delay = 2
+	}
+	return timeout, delay
+}
 
-	data := types.HarnessEnvironment{
+// EnvironmentPayload will return the payload used to create the chaos environment
+func EnvironmentPayload(params types.OnboardingParameters) types.HarnessEnvironment {
+
+	if params.Environment.EnvironmentName == "" {
+		params.Environment.EnvironmentName = params.Infra.Name + "-env"
+	}
+	return types.HarnessEnvironment{
 		OrgIdentifier:     params.Organisation,
 		ProjectIdentifier: params.Project,
 		Identifier:        convertString(params.Environment.EnvironmentName),
 		Name:              params.Environment.EnvironmentName,
 		Description:       params.Environment.EnvironmentDescription,
 		Type:              params.Environment.EnvironmentType,
+		Tags:              map[string]string{types.ManagedByKey: types.ManagedByValue},
+	}
+}
+
+// InfraRequest will return the graphql variables used to register the chaos infra
+func InfraRequest(params types.OnboardingParameters) types.Variables {
+
+	if params.Environment.EnvironmentName == "" {
+		params.Environment.EnvironmentName = params.Infra.Name + "-env"
+	}
+	if params.Infra.PlatformName == "" {
+		params.Infra.PlatformName = params.Infra.Name + "-platform"
+	}
+	return types.Variables{
+		Identifiers: types.Identifiers{
+			OrgIdentifier:     params.Organisation,
+			AccountIdentifier: params.AccountId,
+			ProjectIdentifier: params.Project,
+		},
+		Request: types.Request{
+			Name:                 params.Infra.Name,
+			EnvironmentID:        convertString(params.Environment.EnvironmentName),
+			Description:          params.Infra.InfraDescription,
+			PlatformName:         params.Infra.PlatformName,
+			InfraNamespace:       params.Infra.Namespace,
+			ServiceAccount:       params.Infra.ServiceAccount,
+			InfraScope:           params.Infra.InfraScope,
+			InfraNsExists:        params.Infra.InfraNsExists,
+			InfraSaExists:        params.Infra.InfraSaExists,
+			InstallationType:     "MANIFEST",
+			SkipSsl:              params.Infra.SkipSsl,
+			IsAutoUpgradeEnabled: params.Infra.IsAutoUpgradeEnabled,
+			Tags:                 []string{types.ManagedInfraTag},
+		},
+	}
+}
+
+// ManifestObjects will return the objects of the chaos infra manifest without applying them
+func ManifestObjects(manifest string, params types.OnboardingParameters) ([]types.AppliedObject, error) {
+
+	objects, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []types.AppliedObject
+	for _, obj := range objects {
+		result = append(result, toAppliedObject(obj, params.Infra.Namespace))
 	}
+	return result, nil
+}
+
+// toAppliedObject will return the identity of the given manifest object in the given namespace
+func toAppliedObject(obj *unstructured.Unstructured, namespace string) types.AppliedObject {
+	gvk := obj.GroupVersionKind()
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	return types.AppliedObject{
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Kind:      gvk.Kind,
+		Namespace: namespace,
+		Name:      obj.GetName(),
+	}
+}
+
+// createChaosEnvironment will create the chaos environment for chaos infra
+func createChaosEnvironment(params types.OnboardingParameters) error {
+
+	data := EnvironmentPayload(params)
 
 	payloadBuf := new(bytes.Buffer)
 	if err := ejson.NewEncoder(payloadBuf).Encode(data); err != nil {
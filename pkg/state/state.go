@@ -0,0 +1,180 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uditgaurav/onboard_hce_aws/pkg/types"
+)
+
+// InfraState is the recorded progress and outputs of the onboarding of a single chaos infra
+type InfraState struct {
+	AccountID      string                `json:"accountID"`
+	Organisation   string                `json:"organisation"`
+	Project        string                `json:"project"`
+	InfraName      string                `json:"infraName"`
+	EnvironmentID  string                `json:"environmentID,omitempty"`
+	InfraID        string                `json:"infraID,omitempty"`
+	ProviderARN    string                `json:"providerARN,omitempty"`
+	PolicyARNs     []string              `json:"policyARNs,omitempty"`
+	PolicyInputs   string                `json:"policyInputs,omitempty"`
+	RoleARN        string                `json:"roleARN,omitempty"`
+	AppliedObjects []types.AppliedObject `json:"appliedObjects,omitempty"`
+	CompletedSteps []string              `json:"completedSteps,omitempty"`
+	FailedStep     string                `json:"failedStep,omitempty"`
+	LastError      string                `json:"lastError,omitempty"`
+	UpdatedAt      time.Time             `json:"updatedAt"`
+}
+
+// Store is the onboarding state file holding the state of every infra onboarded from this machine
+type Store struct {
+	path   string
+	Infras map[string]*InfraState `json:"infras"`
+	// owned are the keys of the infras read or changed through this store, only they are written on save
+	owned map[string]bool
+}
+
+// saveMu serializes the saves of the stores of the infras onboarded in parallel
+var saveMu sync.Mutex
+
+// DefaultPath returns the default location of the state file
+func DefaultPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".hce", "onboarding-state.json")
+}
+
+// Key returns the key of the infra state derived from the account, organisation, project and infra name
+func Key(params types.OnboardingParameters) string {
+	return fmt.Sprintf("%s/%s/%s/%s", params.AccountId, params.Organisation, params.Project, params.Infra.Name)
+}
+
+// Load reads the state file from the given path, a missing file results in an empty store
+func Load(path string) (*Store, error) {
+	store := &Store{path: path, Infras: map[string]*InfraState{}, owned: map[string]bool{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, errors.Errorf("failed to read state file '%v', err: %v", path, err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, errors.Errorf("failed to parse state file '%v', err: %v", path, err)
+	}
+	if store.Infras == nil {
+		store.Infras = map[string]*InfraState{}
+	}
+	return store, nil
+}
+
+// Get returns the state of the given infra, creating an empty one if it is not recorded yet
+func (s *Store) Get(params types.OnboardingParameters) *InfraState {
+	key := Key(params)
+	s.owned[key] = true
+	if infra, ok := s.Infras[key]; ok {
+		return infra
+	}
+	infra := &InfraState{
+		AccountID:    params.AccountId,
+		Organisation: params.Organisation,
+		Project:      params.Project,
+		InfraName:    params.Infra.Name,
+	}
+	s.Infras[key] = infra
+	return infra
+}
+
+// Remove deletes the recorded state of the given infra
+func (s *Store) Remove(params types.OnboardingParameters) {
+	s.owned[Key(params)] = true
+	delete(s.Infras, Key(params))
+}
+
+// Save writes the state file, the file is replaced atomically so that a crash never leaves it truncated. The
+// state of the infras of this store is merged into the file as it is now, so the stores of the infras onboarded
+// in parallel don't overwrite each other.
+func (s *Store) Save() error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	current, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	for key := range s.owned {
+		if infra, ok := s.Infras[key]; ok {
+			current.Infras[key] = infra
+		} else {
+			delete(current.Infras, key)
+		}
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return errors.Errorf("failed to encode state, err: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Errorf("failed to create state directory, err: %v", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Errorf("failed to write state file '%v', err: %v", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errors.Errorf("failed to write state file '%v', err: %v", s.path, err)
+	}
+	return nil
+}
+
+// IsCompleted checks if the given step is already completed
+func (i *InfraState) IsCompleted(step string) bool {
+	for _, completed := range i.CompletedSteps {
+		if completed == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete marks the given step as completed
+func (i *InfraState) Complete(step string) {
+	if !i.IsCompleted(step) {
+		i.CompletedSteps = append(i.CompletedSteps, step)
+	}
+	if i.FailedStep == step {
+		i.FailedStep = ""
+		i.LastError = ""
+	}
+	i.UpdatedAt = time.Now()
+}
+
+// Restart clears the completion of the given steps so that they are performed again, the outputs of the other steps
+// are kept for the steps which need them and for deregister
+func (i *InfraState) Restart(steps []string) {
+	restarted := map[string]bool{}
+	for _, step := range steps {
+		restarted[step] = true
+	}
+	var completed []string
+	for _, step := range i.CompletedSteps {
+		if !restarted[step] {
+			completed = append(completed, step)
+		}
+	}
+	i.CompletedSteps = completed
+	if restarted[i.FailedStep] {
+		i.FailedStep = ""
+		i.LastError = ""
+	}
+}
+
+// Fail records the failure of the given step
+func (i *InfraState) Fail(step string, err error) {
+	i.FailedStep = step
+	i.LastError = err.Error()
+	i.UpdatedAt = time.Now()
+}
@@ -0,0 +1,14 @@
+package types
+
+const (
+	// ManagedByKey is the label/tag key used to mark the objects created by this cli
+	ManagedByKey = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByKey for the objects created by this cli
+	ManagedByValue = "onboard_hce_aws"
+	// ManagedInfraTag is the tag marking the chaos infras registered in harness by this cli
+	ManagedInfraTag = ManagedByKey + "=" + ManagedByValue
+	// InfraIDLabel is the label holding the chaos infra ID on the applied manifest objects
+	InfraIDLabel = "hce.harness.io/infra-id"
+	// RoleARNAnnotation is the IRSA annotation added to the experiment service account
+	RoleARNAnnotation = "eks.amazonaws.com/role-arn"
+)
@@ -27,18 +27,19 @@ type Identifiers struct {
 }
 
 type Request struct {
-	Name                 string `json:"name"`
-	EnvironmentID        string `json:"environmentID"`
-	Description          string `json:"description"`
-	PlatformName         string `json:"platformName"`
-	InfraNamespace       string `json:"infraNamespace"`
-	ServiceAccount       string `json:"serviceAccount"`
-	InfraScope           string `json:"infraScope"`
-	InfraNsExists        bool   `json:"infraNsExists"`
-	InfraSaExists        bool   `json:"infraSaExists"`
-	InstallationType     string `json:"installationType"`
-	SkipSsl              bool   `json:"skipSsl"`
-	IsAutoUpgradeEnabled bool   `json:"isAutoUpgradeEnabled"`
+	Name                 string   `json:"name"`
+	EnvironmentID        string   `json:"environmentID"`
+	Description          string   `json:"description"`
+	PlatformName         string   `json:"platformName"`
+	InfraNamespace       string   `json:"infraNamespace"`
+	ServiceAccount       string   `json:"serviceAccount"`
+	InfraScope           string   `json:"infraScope"`
+	InfraNsExists        bool     `json:"infraNsExists"`
+	InfraSaExists        bool     `json:"infraSaExists"`
+	InstallationType     string   `json:"installationType"`
+	SkipSsl              bool     `json:"skipSsl"`
+	IsAutoUpgradeEnabled bool     `json:"isAutoUpgradeEnabled"`
+	Tags                 []string `json:"tags"`
 }
 
 type Payload struct {
@@ -51,6 +52,65 @@ type Variables struct {
 	Request     Request     `json:"request"`
 }
 
+// TrustSubject is a service account allowed to assume the chaos role, the namespace and service account
+// can contain '*' and '?' wildcards. The provider URL defaults to the one of the infra.
+type TrustSubject struct {
+	ProviderUrl    string
+	Namespace      string
+	ServiceAccount string
+}
+
+// PolicyScope restricts the mutating actions of the chaos policy to the matching resources, every field is a comma
+// separated list and the tags are given as key=value
+type PolicyScope struct {
+	Tags         string
+	ResourceARNs string
+	Regions      string
+	VPCs         string
+}
+
+// Guardrail denies the chaos actions against protected resources, selected by tags, EC2 instance IDs, RDS DB
+// instance identifiers or regions. The actions default to every mutating action of the chaos policy.
+type Guardrail struct {
+	Name          string
+	Tags          map[string]string
+	InstanceIDs   []string
+	DBInstanceIDs []string
+	Regions       []string
+	Actions       []string
+}
+
+// IAMOptions are the organisation requirements of the IAM resources created by the cli. The tags are comma
+// separated key=value pairs added to the role, policies and OIDC provider, the path and description apply to the
+// role and policies, and the permissions boundary and maximum session duration in seconds to the role.
+// ManagedPolicyARNs are comma separated ARNs of existing managed policies attached to the chaos role, and
+// InlinePolicy puts the chaos policy inline in the created role instead of creating managed policies.
+type IAMOptions struct {
+	PermissionsBoundary string
+	Tags                string
+	Path                string
+	Description         string
+	MaxSessionDuration  int
+	ManagedPolicyARNs   string
+	InlinePolicy        bool
+}
+
+// NamingOptions are the naming template of the role and policies created by the cli, rendered with the Prefix of
+// the resource, the Cluster and the infra Namespace, e.g. {{.Prefix}}-{{.Cluster}}-{{.Namespace}}
+type NamingOptions struct {
+	Template string
+	Cluster  string
+}
+
+// KubeOptions are the settings of the clients of the cluster: the Context of the kubeconfig, the user or service
+// account the requests are impersonated As, and the QPS and Burst of the client side rate limiter
+type KubeOptions struct {
+	Context string
+	As      string
+	QPS     float32
+	Burst   int
+}
+
 type OnboardingParameters struct {
 	ApiKey                       string
 	AccountId                    string
@@ -62,17 +122,30 @@ type OnboardingParameters struct {
 	Delay                        int
 	ProviderUrl                  string
 	ProviderARN                  string
+	Thumbprint                   string
+	CABundle                     string
+	EKSClusterName               string
 	RoleName                     string
 	RoleARN                      string
+	TrustSubjects                []TrustSubject
 	Resources                    string
+	Faults                       string
+	PolicyCatalog                string
+	Scope                        PolicyScope
+	Guardrails                   []Guardrail
+	IAM                          IAMOptions
+	Naming                       NamingOptions
 	Region                       string
 	ExperimentServiceAccountName string
 	KubeConfigPath               string
+	Kube                         KubeOptions
 	Actions                      string
 	AWSCredentialFile            string
 	AWSProfile                   string
 	Dryrun                       bool
 	CreateNS                     bool
+	StateFile                    string
+	Resume                       bool
 }
 
 type Response struct {
@@ -97,3 +170,40 @@ type HarnessEnvironment struct {
 	Type              string            `json:"type"`
 	Yaml              string            `json:"yaml"`
 }
+
+// DeregisterOptions holds the optional teardown steps performed by the deregister command
+type DeregisterOptions struct {
+	InfraID            string
+	DeleteEnvironment  bool
+	DeleteOIDCProvider bool
+}
+
+// AppliedObject identifies a kubernetes object applied from the chaos infra manifest
+type AppliedObject struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ChaosInfra is the chaos infra as returned by the getInfra query
+type ChaosInfra struct {
+	InfraID               string   `json:"infraID"`
+	Name                  string   `json:"name"`
+	EnvironmentID         string   `json:"environmentID"`
+	PlatformName          string   `json:"platformName"`
+	Tags                  []string `json:"tags"`
+	IsActive              bool     `json:"isActive"`
+	IsInfraConfirmed      bool     `json:"isInfraConfirmed"`
+	IsRemoved             bool     `json:"isRemoved"`
+	UpdatedAt             string   `json:"updatedAt"`
+	CreatedAt             string   `json:"createdAt"`
+	InfraNamespace        string   `json:"infraNamespace"`
+	ServiceAccount        string   `json:"serviceAccount"`
+	InfraScope            string   `json:"infraScope"`
+	LastWorkflowTimestamp string   `json:"lastWorkflowTimestamp"`
+	StartTime             string   `json:"startTime"`
+	Version               string   `json:"version"`
+}